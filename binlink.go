@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Ways of installing a bin entry, set with bin-mode.
+const (
+	binModeSymlink         = "symlink"
+	binModeRelativeSymlink = "relative-symlink"
+	binModeHardlink        = "hardlink"
+	binModeCopy            = "copy"
+	binModeShim            = "shim"
+)
+
+var binModes = []string{binModeSymlink, binModeRelativeSymlink, binModeHardlink, binModeCopy, binModeShim}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// itemDirMatcher finds the placeholder for the installed item directory in
+// bin-env values.
+var itemDirMatcher = regexp.MustCompile(`(?i)\$item-dir`)
+
+func validateBinMode(mode string) error {
+	if mode == "" {
+		return nil
+	}
+	for _, binMode := range binModes {
+		if mode == binMode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown mode %q, expected one of: %s", mode, strings.Join(binModes, ", "))
+}
+
+func (item FetchItem) GetBinMode(globalBinMode string) string {
+	if item.BinMode != "" {
+		return item.BinMode
+	}
+	if globalBinMode != "" {
+		return globalBinMode
+	}
+	return binModeSymlink
+}
+
+// itemBinEnv returns the bin-env of an item with $item-dir expanded to the
+// absolute path of itemPath.
+func itemBinEnv(item FetchItem, itemPath string) (map[string]string, error) {
+	if len(item.BinEnv) == 0 {
+		return nil, nil
+	}
+	itemDir, err := filepath.Abs(itemPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve absolute path for item: %w", err)
+	}
+	return expandBinEnv(item.BinEnv, itemDir), nil
+}
+
+// expandBinEnv replaces $item-dir in bin-env values with the installed item
+// directory.
+func expandBinEnv(env map[string]string, itemDir string) map[string]string {
+	expanded := make(map[string]string, len(env))
+	for name, value := range env {
+		expanded[name] = itemDirMatcher.ReplaceAllLiteralString(value, itemDir)
+	}
+	return expanded
+}
+
+// binEntry is one entry to install in the bin directory. Target is where the
+// file it runs will be installed; Source is the file to hard link or copy,
+// which may still be staged.
+type binEntry struct {
+	Name   string
+	Target string
+	Source string
+}
+
+// checkBinOwnership refuses to replace entries in binDir that another item or
+// the user put there. An entry belongs to the item if it was recorded for it
+// in the state file, or if it is a symlink into itemRoot.
+func checkBinOwnership(binDir string, entries []binEntry, owned map[string]bool, itemRoot string) error {
+	absItemRoot, err := filepath.Abs(itemRoot)
+	if err != nil {
+		return fmt.Errorf("failed to resolve absolute path for item: %w", err)
+	}
+
+	for _, entry := range entries {
+		linkPath := filepath.Join(binDir, entry.Name)
+		if _, err := os.Lstat(linkPath); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to check %s: %w", linkPath, err)
+		}
+		if owned[linkPath] {
+			continue
+		}
+
+		if linkTarget, err := os.Readlink(linkPath); err == nil {
+			if !filepath.IsAbs(linkTarget) {
+				linkTarget = filepath.Join(filepath.Dir(linkPath), linkTarget)
+			}
+			absTarget, err := filepath.Abs(linkTarget)
+			if err == nil && pathWithin(absTarget, absItemRoot) {
+				continue
+			}
+		}
+
+		return fmt.Errorf("%s already exists and was not installed by this item, remove it first", linkPath)
+	}
+
+	return nil
+}
+
+// pathWithin reports whether path is root or lies below it.
+func pathWithin(path, root string) bool {
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
+
+// checkBinEntry reports an error unless the entry at linkPath still runs the
+// absolute path target the way mode installed it: symlinks must point at it,
+// hard links share its inode, and copies and shims hold the expected content.
+func checkBinEntry(linkPath, target, mode string, env map[string]string) error {
+	info, err := os.Lstat(linkPath)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case binModeSymlink, binModeRelativeSymlink:
+		linkTarget, err := os.Readlink(linkPath)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(linkTarget) {
+			linkTarget = filepath.Join(filepath.Dir(linkPath), linkTarget)
+		}
+		absLinkTarget, err := filepath.Abs(linkTarget)
+		if err != nil {
+			return err
+		}
+		if absLinkTarget != target {
+			return fmt.Errorf("%s points to %s instead of %s", linkPath, absLinkTarget, target)
+		}
+
+	case binModeHardlink:
+		targetInfo, err := os.Stat(target)
+		if err != nil {
+			return err
+		}
+		if !os.SameFile(info, targetInfo) {
+			return fmt.Errorf("%s is no longer a hard link to %s", linkPath, target)
+		}
+
+	case binModeCopy, binModeShim:
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", linkPath)
+		}
+		expected := []byte(shimScript(target, env))
+		if mode == binModeCopy {
+			if expected, err = os.ReadFile(target); err != nil {
+				return err
+			}
+		}
+		content, err := os.ReadFile(linkPath)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(content, expected) {
+			return fmt.Errorf("%s was modified", linkPath)
+		}
+
+	default:
+		return fmt.Errorf("unknown bin-mode %q", mode)
+	}
+
+	return nil
+}
+
+// preparedBinEntries are bin entries staged inside the bin directory, ready
+// to be renamed into place.
+type preparedBinEntries struct {
+	binDir       string
+	stagingDir   string
+	descriptions []string
+	entries      []binEntry
+	committed    int
+}
+
+// prepareBinEntries creates bin entries in a staging directory inside binDir,
+// so an unwritable bin directory fails before anything is replaced.
+func prepareBinEntries(binDir, owner string, entries []binEntry, mode string, env map[string]string) (*preparedBinEntries, error) {
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create bin directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Name != filepath.Base(entry.Name) || !filepath.IsLocal(entry.Name) {
+			return nil, fmt.Errorf("invalid symlink name %q", entry.Name)
+		}
+	}
+
+	stagingDir, err := os.MkdirTemp(binDir, "."+owner+".staging-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	prepared := &preparedBinEntries{binDir: binDir, stagingDir: stagingDir}
+	for _, entry := range entries {
+		// Convert target path to absolute path to ensure symlink works correctly
+		absTargetPath, err := filepath.Abs(entry.Target)
+		if err != nil {
+			prepared.cleanup()
+			return nil, fmt.Errorf("failed to resolve absolute path for target: %w", err)
+		}
+		absSourcePath, err := filepath.Abs(entry.Source)
+		if err != nil {
+			prepared.cleanup()
+			return nil, fmt.Errorf("failed to resolve absolute path for target: %w", err)
+		}
+		entry.Target = absTargetPath
+
+		description, err := stageBinLink(filepath.Join(stagingDir, entry.Name), absTargetPath, absSourcePath, binDir, mode, env)
+		if err != nil {
+			prepared.cleanup()
+			return nil, err
+		}
+		prepared.entries = append(prepared.entries, entry)
+		prepared.descriptions = append(prepared.descriptions, description)
+	}
+
+	return prepared, nil
+}
+
+// commit renames the staged entries into the bin directory. If one fails,
+// the entries replaced before it are restored.
+func (prepared *preparedBinEntries) commit() error {
+	backupDir := filepath.Join(prepared.stagingDir, ".previous")
+	if err := os.Mkdir(backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	for i, entry := range prepared.entries {
+		linkPath := filepath.Join(prepared.binDir, entry.Name)
+		if err := swapIntoPlace(filepath.Join(prepared.stagingDir, entry.Name), linkPath, filepath.Join(backupDir, entry.Name)); err != nil {
+			if restoreErr := prepared.restore(); restoreErr != nil {
+				return fmt.Errorf("%w (restoring the previous bin entries also failed: %v)", err, restoreErr)
+			}
+			return err
+		}
+		prepared.committed++
+		fmt.Printf("Created %s: %s -> %s\n", prepared.descriptions[i], linkPath, entry.Target)
+	}
+
+	return nil
+}
+
+// restore puts back the entries that commit replaced.
+func (prepared *preparedBinEntries) restore() error {
+	backupDir := filepath.Join(prepared.stagingDir, ".previous")
+	for i := prepared.committed - 1; i >= 0; i-- {
+		name := prepared.entries[i].Name
+		if err := restoreFromBackup(filepath.Join(prepared.binDir, name), filepath.Join(backupDir, name)); err != nil {
+			return err
+		}
+	}
+	prepared.committed = 0
+	return nil
+}
+
+// cleanup removes the staging directory with any backups in it.
+func (prepared *preparedBinEntries) cleanup() {
+	os.RemoveAll(prepared.stagingDir)
+}
+
+// stageBinLink creates the bin entry at stagedLink and returns a description
+// of what was created. Hard links and copies are made from absSourcePath.
+func stageBinLink(stagedLink, absTargetPath, absSourcePath, binDir, mode string, env map[string]string) (string, error) {
+	switch mode {
+	case binModeSymlink:
+		if err := os.Symlink(absTargetPath, stagedLink); err != nil {
+			return "", fmt.Errorf("failed to create symlink: %w", err)
+		}
+		return "symlink", nil
+
+	case binModeRelativeSymlink:
+		absBinDir, err := filepath.Abs(binDir)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve absolute path for bin directory: %w", err)
+		}
+		relTarget, err := filepath.Rel(absBinDir, absTargetPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to make target relative to %s: %w", binDir, err)
+		}
+		if err := os.Symlink(relTarget, stagedLink); err != nil {
+			return "", fmt.Errorf("failed to create symlink: %w", err)
+		}
+		return "relative symlink", nil
+
+	case binModeHardlink:
+		// Link the file itself rather than a symlink to it, whose relative
+		// target would not resolve from the bin directory
+		realTarget, err := filepath.EvalSymlinks(absSourcePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve target: %w", err)
+		}
+		if err := os.Link(realTarget, stagedLink); err != nil {
+			return "", fmt.Errorf("failed to create hard link: %w", err)
+		}
+		return "hard link", nil
+
+	case binModeCopy:
+		data, err := os.ReadFile(absSourcePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read target: %w", err)
+		}
+		if err := os.WriteFile(stagedLink, data, 0755); err != nil {
+			return "", fmt.Errorf("failed to write copy: %w", err)
+		}
+		return "copy", nil
+
+	case binModeShim:
+		if err := os.WriteFile(stagedLink, []byte(shimScript(absTargetPath, env)), 0755); err != nil {
+			return "", fmt.Errorf("failed to write shim: %w", err)
+		}
+		return "shim", nil
+
+	default:
+		return "", fmt.Errorf("unknown bin-mode %q", mode)
+	}
+}
+
+// shimScript returns a shell script that exports env and then runs target
+// with the script's arguments.
+func shimScript(target string, env map[string]string) string {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n# Generated by vfetch, changes are overwritten on the next install\n")
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&script, "export %s=%s\n", name, shellQuote(env[name]))
+	}
+
+	fmt.Fprintf(&script, "exec %s \"$@\"\n", shellQuote(target))
+	return script.String()
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// installBinEntry prepares and commits a single bin entry the way
+// ProcessFetchItem does.
+func installBinEntry(targetPath, binDir, name, mode string, env map[string]string) error {
+	prepared, err := prepareBinEntries(binDir, name, []binEntry{{Name: name, Target: targetPath, Source: targetPath}}, mode, env)
+	if err != nil {
+		return err
+	}
+	defer prepared.cleanup()
+
+	return prepared.commit()
+}
+
+func TestPrepareBinEntriesModes(t *testing.T) {
+	script := "#!/bin/sh\necho \"home=$TOOL_HOME args=$*\"\n"
+
+	tests := []struct {
+		name    string
+		mode    string
+		env     map[string]string
+		checkFn func(t *testing.T, linkPath, targetPath string)
+	}{
+		{
+			name: "symlink",
+			mode: binModeSymlink,
+			checkFn: func(t *testing.T, linkPath, targetPath string) {
+				linkTarget, err := os.Readlink(linkPath)
+				if err != nil {
+					t.Fatalf("Failed to read symlink: %v", err)
+				}
+				if linkTarget != targetPath {
+					t.Errorf("Expected symlink target %q, got %q", targetPath, linkTarget)
+				}
+			},
+		},
+		{
+			name: "relative symlink",
+			mode: binModeRelativeSymlink,
+			checkFn: func(t *testing.T, linkPath, targetPath string) {
+				linkTarget, err := os.Readlink(linkPath)
+				if err != nil {
+					t.Fatalf("Failed to read symlink: %v", err)
+				}
+				if linkTarget != filepath.Join("..", "tools", "tool", "bin", "tool") {
+					t.Errorf("Expected relative symlink target, got %q", linkTarget)
+				}
+			},
+		},
+		{
+			name: "hardlink",
+			mode: binModeHardlink,
+			checkFn: func(t *testing.T, linkPath, targetPath string) {
+				linkInfo, err := os.Lstat(linkPath)
+				if err != nil {
+					t.Fatalf("Failed to stat link: %v", err)
+				}
+				targetInfo, err := os.Stat(targetPath)
+				if err != nil {
+					t.Fatalf("Failed to stat target: %v", err)
+				}
+				if !os.SameFile(linkInfo, targetInfo) {
+					t.Errorf("Expected %s to be a hard link to %s", linkPath, targetPath)
+				}
+			},
+		},
+		{
+			name: "copy",
+			mode: binModeCopy,
+			checkFn: func(t *testing.T, linkPath, targetPath string) {
+				linkInfo, err := os.Lstat(linkPath)
+				if err != nil {
+					t.Fatalf("Failed to stat copy: %v", err)
+				}
+				targetInfo, err := os.Stat(targetPath)
+				if err != nil {
+					t.Fatalf("Failed to stat target: %v", err)
+				}
+				if !linkInfo.Mode().IsRegular() || os.SameFile(linkInfo, targetInfo) {
+					t.Errorf("Expected %s to be a separate regular file", linkPath)
+				}
+			},
+		},
+		{
+			name: "shim",
+			mode: binModeShim,
+			env:  map[string]string{"TOOL_HOME": "/opt/it's here"},
+			checkFn: func(t *testing.T, linkPath, targetPath string) {
+				output, err := exec.Command(linkPath, "a", "b").Output()
+				if err != nil {
+					t.Fatalf("Failed to run shim: %v", err)
+				}
+				if string(output) != "home=/opt/it's here args=a b\n" {
+					t.Errorf("Unexpected shim output %q", output)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			targetPath := filepath.Join(tmpDir, "tools", "tool", "bin", "tool")
+			binDir := filepath.Join(tmpDir, "bin")
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				t.Fatalf("Failed to create target dir: %v", err)
+			}
+			if err := os.WriteFile(targetPath, []byte(script), 0755); err != nil {
+				t.Fatalf("Failed to create target file: %v", err)
+			}
+
+			if err := installBinEntry(targetPath, binDir, "tool", tt.mode, tt.env); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			linkPath := filepath.Join(binDir, "tool")
+			tt.checkFn(t, linkPath, targetPath)
+
+			content, err := os.ReadFile(linkPath)
+			if err != nil {
+				t.Fatalf("Failed to read bin entry: %v", err)
+			}
+			if tt.mode != binModeShim && string(content) != script {
+				t.Errorf("Expected bin entry to reach the target, got %q", content)
+			}
+
+			entries, err := os.ReadDir(binDir)
+			if err != nil {
+				t.Fatalf("Failed to read bin dir: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("Expected only the bin entry in %s, got %d entries", binDir, len(entries))
+			}
+		})
+	}
+}
+
+func TestRelativeSymlinkSurvivesRelocation(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	root := filepath.Join(tmpDir, "root")
+	targetPath := filepath.Join(root, "tools", "tool")
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		t.Fatalf("Failed to create target dir: %v", err)
+	}
+	if err := os.WriteFile(targetPath, []byte("tool"), 0755); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	if err := installBinEntry(targetPath, filepath.Join(root, "bin"), "tool", binModeRelativeSymlink, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	moved := filepath.Join(tmpDir, "moved")
+	if err := os.Rename(root, moved); err != nil {
+		t.Fatalf("Failed to move tree: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(moved, "bin", "tool"))
+	if err != nil {
+		t.Fatalf("Expected relative symlink to resolve after relocation: %v", err)
+	}
+	if string(content) != "tool" {
+		t.Errorf("Unexpected content %q", content)
+	}
+}
+
+func TestShimScript(t *testing.T) {
+	script := shimScript("/opt/jdk/bin/java", map[string]string{
+		"JAVA_HOME": "/opt/jdk",
+		"A_FLAG":    "it's",
+	})
+
+	expectedLines := []string{
+		"#!/bin/sh",
+		"export A_FLAG='it'\\''s'",
+		"export JAVA_HOME='/opt/jdk'",
+		"exec '/opt/jdk/bin/java' \"$@\"",
+	}
+
+	lastIndex := -1
+	for _, line := range expectedLines {
+		index := strings.Index(script, line+"\n")
+		if index < 0 {
+			t.Errorf("Expected shim to contain %q, got:\n%s", line, script)
+			continue
+		}
+		if index < lastIndex {
+			t.Errorf("Expected %q to come later in the shim, got:\n%s", line, script)
+		}
+		lastIndex = index
+	}
+}
+
+func TestProcessFetchItemWithShim(t *testing.T) {
+	script := []byte("#!/bin/sh\necho \"$TOOL_HOME\"\n")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(script)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outputDir := filepath.Join(tmpDir, "output")
+	binDir := filepath.Join(tmpDir, "bin")
+	config := &Config{
+		OutputDir: outputDir,
+		BinsDir:   binDir,
+		BinMode:   binModeShim,
+	}
+
+	item := FetchItem{
+		Name:      "tool",
+		URL:       server.URL + "/tool",
+		Version:   "1.0",
+		Hash:      fmt.Sprintf("sha256:%x", sha256.Sum256(script)),
+		BinFile:   true,
+		BinEnv:    map[string]string{"TOOL_HOME": "$item-dir"},
+		Versioned: true,
+	}
+
+	if err := ProcessFetchItem(config, item); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output, err := exec.Command(filepath.Join(binDir, "tool")).Output()
+	if err != nil {
+		t.Fatalf("Failed to run shim: %v", err)
+	}
+	expected := filepath.Join(outputDir, "tool", currentLink) + "\n"
+	if string(output) != expected {
+		t.Errorf("Expected shim to export %q, got %q", expected, output)
+	}
+}
@@ -5,31 +5,71 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/tidwall/jsonc"
 )
 
 type Config struct {
-	OutputDir string      `json:"output-dir"`
-	BinsDir   string      `json:"bins-dir"`
-	Fetch     []FetchItem `json:"fetch"`
+	OutputDir     string        `json:"output-dir"`
+	BinsDir       string        `json:"bins-dir"`
+	ExtractLimits ExtractLimits `json:"extract-limits"`
+	KeepVersions  int           `json:"keep-versions"`
+	BinMode       string        `json:"bin-mode"`
+	Fetch         []FetchItem   `json:"fetch"`
+
+	// Force reinstalls items that are already up to date; set from -force
+	Force bool `json:"-"`
 }
 
 type FetchItem struct {
-	Name       string      `json:"name"`
-	URL        string      `json:"url"`
-	Version    string      `json:"version"`
-	Hash       string      `json:"hash"`
-	Hashes     []string    `json:"hashes"`
-	Extract    bool        `json:"extract"`
-	BinFile    interface{} `json:"bin-file"`
-	BinDir     string      `json:"bin-dir"`
-	OutputDir  string      `json:"output-dir"`
-	HomeURL    string      `json:"home-url,omitempty"`
-	SourceURL  string      `json:"source-url,omitempty"`
-	LicenseURL string      `json:"license-url,omitempty"`
-	AuthorURL  string      `json:"author-url,omitempty"`
+	Name            string            `json:"name"`
+	URL             string            `json:"url"`
+	Version         string            `json:"version"`
+	Hash            string            `json:"hash"`
+	Hashes          []string          `json:"hashes"`
+	Extract         bool              `json:"extract"`
+	Decompress      bool              `json:"decompress"`
+	ArchiveType     string            `json:"archive-type"`
+	StripComponents int               `json:"strip-components"`
+	Include         []string          `json:"include"`
+	Exclude         []string          `json:"exclude"`
+	ExtractLimits   ExtractLimits     `json:"extract-limits"`
+	ExtractNested   []NestedArchive   `json:"extract-nested"`
+	StripSetuid     bool              `json:"strip-setuid"`
+	NormalizeMtime  bool              `json:"normalize-mtime"`
+	FileHashes      map[string]string `json:"file-hashes"`
+	TreeHash        string            `json:"tree-hash"`
+	BinFile         interface{}       `json:"bin-file"`
+	BinFiles        interface{}       `json:"bin-files"`
+	BinDirs         []BinDirectory    `json:"bin-dirs"`
+	BinMode         string            `json:"bin-mode"`
+	BinEnv          map[string]string `json:"bin-env"`
+	BinDir          string            `json:"bin-dir"`
+	OutputDir       string            `json:"output-dir"`
+	Versioned       bool              `json:"versioned"`
+	KeepVersions    int               `json:"keep-versions"`
+	HomeURL         string            `json:"home-url,omitempty"`
+	SourceURL       string            `json:"source-url,omitempty"`
+	LicenseURL      string            `json:"license-url,omitempty"`
+	AuthorURL       string            `json:"author-url,omitempty"`
+}
+
+// NestedArchive names an archive inside the extracted files that is
+// extracted in turn, optionally after checking its hash.
+type NestedArchive struct {
+	Path        string `json:"path"`
+	Hash        string `json:"hash"`
+	ArchiveType string `json:"archive-type"`
+}
+
+// BinDirectory names a directory inside the extracted files whose executables
+// are all linked into the bin directory, optionally filtered by file name.
+type BinDirectory struct {
+	Path    string   `json:"path"`
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
 }
 
 func LoadConfig(configPath string) (*Config, error) {
@@ -65,11 +105,27 @@ func LoadConfig(configPath string) (*Config, error) {
 	return &config, nil
 }
 
+// reservedItemNames are the subcommands, which take the place of item names
+// as the first argument.
+var reservedItemNames = []string{"treehash", "verify", "use", "rollback"}
+
 func ValidateConfig(config *Config) error {
 	if len(config.Fetch) == 0 {
 		return fmt.Errorf("no fetch items specified")
 	}
 
+	if err := config.ExtractLimits.validate(); err != nil {
+		return fmt.Errorf("invalid 'extract-limits': %w", err)
+	}
+
+	if config.KeepVersions < 0 {
+		return fmt.Errorf("invalid 'keep-versions': must not be negative")
+	}
+
+	if err := validateBinMode(config.BinMode); err != nil {
+		return fmt.Errorf("invalid 'bin-mode': %w", err)
+	}
+
 	// Check for duplicate names
 	namesSeen := make(map[string]int)
 	for i, item := range config.Fetch {
@@ -83,6 +139,28 @@ func ValidateConfig(config *Config) error {
 		if err := validateFetchItem(item, i); err != nil {
 			return err
 		}
+		if len(item.BinEnv) > 0 && item.GetBinMode(config.BinMode) != binModeShim {
+			return fmt.Errorf("fetch item %d (%s): 'bin-env' requires bin-mode to be %q", i, item.Name, binModeShim)
+		}
+		// Hard links and copies hold one version, so they would not follow
+		// use and rollback, and would keep pruned versions around
+		if binMode := item.GetBinMode(config.BinMode); item.Versioned && item.hasBinLinks() && (binMode == binModeHardlink || binMode == binModeCopy) {
+			return fmt.Errorf("fetch item %d (%s): 'versioned' cannot be combined with bin-mode %q, use a symlink or shim", i, item.Name, binMode)
+		}
+	}
+
+	// Check for bin links that two items would create in the same place
+	linksSeen := make(map[string]int)
+	for i, item := range config.Fetch {
+		binDir := item.GetBinDir(config.BinsDir)
+		links, _ := item.GetBinLinks()
+		for _, link := range links {
+			linkPath := filepath.Join(binDir, link.Name)
+			if firstIndex, exists := linksSeen[linkPath]; exists {
+				return fmt.Errorf("bin link %s is created by fetch items %d and %d", linkPath, firstIndex, i)
+			}
+			linksSeen[linkPath] = i
+		}
 	}
 
 	return nil
@@ -92,6 +170,11 @@ func validateFetchItem(item FetchItem, index int) error {
 	if item.Name == "" {
 		return fmt.Errorf("fetch item %d: name is required", index)
 	}
+	for _, reserved := range reservedItemNames {
+		if item.Name == reserved {
+			return fmt.Errorf("fetch item %d: name %q is reserved for the %s subcommand", index, item.Name, reserved)
+		}
+	}
 
 	if item.URL == "" {
 		return fmt.Errorf("fetch item %d: URL is required", index)
@@ -106,6 +189,16 @@ func validateFetchItem(item FetchItem, index int) error {
 		return fmt.Errorf("fetch item %d: version field cannot contain version placeholders ($version or $VERSION)", index)
 	}
 
+	if item.Versioned && !isVersionName(item.Version) {
+		return fmt.Errorf("fetch item %d (%s): version %q cannot be used as a directory name in the versioned layout", index, item.Name, item.Version)
+	}
+	if item.KeepVersions < 0 {
+		return fmt.Errorf("fetch item %d (%s): invalid 'keep-versions': must not be negative", index, item.Name)
+	}
+	if item.KeepVersions > 0 && !item.Versioned {
+		return fmt.Errorf("fetch item %d (%s): 'keep-versions' requires versioned to be true", index, item.Name)
+	}
+
 	// Ensure only one of hash or hashes is provided
 	hasHash := item.Hash != ""
 	hasHashes := len(item.Hashes) > 0
@@ -118,21 +211,144 @@ func validateFetchItem(item FetchItem, index int) error {
 		return fmt.Errorf("fetch item %d: cannot specify both 'hash' and 'hashes' fields, use only one", index)
 	}
 
-	validHashTypes := []string{"sha256:", "sha512:", "sha3:", "blake2b:", "blake2s:", "blake3:"}
-
 	// Validate single hash
 	if hasHash {
-		if err := validateHashFormat(item.Hash, validHashTypes, index); err != nil {
-			return err
+		if err := validateHashFormat(item.Hash); err != nil {
+			return fmt.Errorf("fetch item %d (%s): invalid 'hash': %w", index, item.Name, err)
+		}
+		if isWeakHash(item.Hash) {
+			return fmt.Errorf("fetch item %d (%s): invalid 'hash': weak hash cannot be used on its own, use 'hashes' with a strong hash next to it", index, item.Name)
 		}
 	}
 
-	// Validate multiple hashes
+	// Validate multiple hashes, weak ones only count as extra checks
 	if hasHashes {
+		hasStrongHash := false
 		for i, hash := range item.Hashes {
-			if err := validateHashFormat(hash, validHashTypes, index); err != nil {
-				return fmt.Errorf("fetch item %d, hash %d: %w", index, i, err)
+			if err := validateHashFormat(hash); err != nil {
+				return fmt.Errorf("fetch item %d (%s): invalid 'hashes[%d]': %w", index, item.Name, i, err)
 			}
+			if !isWeakHash(hash) {
+				hasStrongHash = true
+			}
+		}
+		if !hasStrongHash {
+			return fmt.Errorf("fetch item %d (%s): invalid 'hashes': at least one strong hash is required next to weak ones", index, item.Name)
+		}
+	}
+
+	if item.Decompress && item.Extract {
+		return fmt.Errorf("fetch item %d (%s): cannot specify both 'extract' and 'decompress', use only one", index, item.Name)
+	}
+
+	if item.ArchiveType != "" {
+		if !item.Extract && !item.Decompress {
+			return fmt.Errorf("fetch item %d (%s): 'archive-type' requires extract or decompress to be true", index, item.Name)
+		}
+		format, err := normalizeArchiveType(item.ArchiveType)
+		if err != nil {
+			return fmt.Errorf("fetch item %d (%s): invalid 'archive-type': %w", index, item.Name, err)
+		}
+		if item.Decompress && compressionNames[format] == "" {
+			return fmt.Errorf("fetch item %d (%s): invalid 'archive-type': decompress supports gz, xz, zst and bz2, not %s", index, item.Name, item.ArchiveType)
+		}
+	}
+
+	if item.StripComponents < 0 {
+		return fmt.Errorf("fetch item %d (%s): invalid 'strip-components': must not be negative", index, item.Name)
+	}
+	if item.StripComponents > 0 && !item.Extract {
+		return fmt.Errorf("fetch item %d (%s): 'strip-components' requires extract to be true", index, item.Name)
+	}
+
+	if err := validateGlobs(item.Include, "include", item, index); err != nil {
+		return err
+	}
+	if err := validateGlobs(item.Exclude, "exclude", item, index); err != nil {
+		return err
+	}
+
+	if err := item.ExtractLimits.validate(); err != nil {
+		return fmt.Errorf("fetch item %d (%s): invalid 'extract-limits': %w", index, item.Name, err)
+	}
+
+	if len(item.ExtractNested) > 0 && !item.Extract {
+		return fmt.Errorf("fetch item %d (%s): 'extract-nested' requires extract to be true", index, item.Name)
+	}
+	for i, nested := range item.ExtractNested {
+		if cleanArchivePath(nested.Path) == "" {
+			return fmt.Errorf("fetch item %d (%s): invalid 'extract-nested[%d]': path is required", index, item.Name, i)
+		}
+		if nested.Hash != "" {
+			if err := validateHashFormat(nested.Hash); err != nil {
+				return fmt.Errorf("fetch item %d (%s): invalid 'extract-nested[%d]' hash: %w", index, item.Name, i, err)
+			}
+			if isWeakHash(nested.Hash) {
+				return fmt.Errorf("fetch item %d (%s): invalid 'extract-nested[%d]' hash: weak hash cannot be used on its own", index, item.Name, i)
+			}
+		}
+		if nested.ArchiveType != "" {
+			if _, err := normalizeArchiveType(nested.ArchiveType); err != nil {
+				return fmt.Errorf("fetch item %d (%s): invalid 'extract-nested[%d]' archive-type: %w", index, item.Name, i, err)
+			}
+		}
+	}
+
+	if err := validateBinMode(item.BinMode); err != nil {
+		return fmt.Errorf("fetch item %d (%s): invalid 'bin-mode': %w", index, item.Name, err)
+	}
+	envNames := make([]string, 0, len(item.BinEnv))
+	for name := range item.BinEnv {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	for _, name := range envNames {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("fetch item %d (%s): invalid 'bin-env': %q is not a valid variable name", index, item.Name, name)
+		}
+	}
+
+	if len(item.BinDirs) > 0 && !item.Extract {
+		return fmt.Errorf("fetch item %d (%s): 'bin-dirs' requires extract to be true", index, item.Name)
+	}
+	for i, binDir := range item.BinDirs {
+		if binDir.Path == "" {
+			return fmt.Errorf("fetch item %d (%s): invalid 'bin-dirs[%d]': path is required", index, item.Name, i)
+		}
+		if !isLocalPath(binDir.Path) {
+			return fmt.Errorf("fetch item %d (%s): invalid 'bin-dirs[%d]': %q escapes the extraction directory", index, item.Name, i, binDir.Path)
+		}
+		if err := validateGlobs(binDir.Include, fmt.Sprintf("bin-dirs[%d].include", i), item, index); err != nil {
+			return err
+		}
+		if err := validateGlobs(binDir.Exclude, fmt.Sprintf("bin-dirs[%d].exclude", i), item, index); err != nil {
+			return err
+		}
+	}
+
+	if len(item.FileHashes) > 0 {
+		if !item.Extract {
+			return fmt.Errorf("fetch item %d (%s): 'file-hashes' requires extract to be true", index, item.Name)
+		}
+		for filePath, hash := range item.FileHashes {
+			if cleanArchivePath(filePath) == "" {
+				return fmt.Errorf("fetch item %d (%s): invalid 'file-hashes' path %q", index, item.Name, filePath)
+			}
+			if err := validateHashFormat(hash); err != nil {
+				return fmt.Errorf("fetch item %d (%s): invalid 'file-hashes[%s]': %w", index, item.Name, filePath, err)
+			}
+			if isWeakHash(hash) {
+				return fmt.Errorf("fetch item %d (%s): invalid 'file-hashes[%s]': weak hash cannot be used on its own", index, item.Name, filePath)
+			}
+		}
+	}
+
+	if item.TreeHash != "" {
+		if !item.Extract {
+			return fmt.Errorf("fetch item %d (%s): 'tree-hash' requires extract to be true", index, item.Name)
+		}
+		if err := validateTreeHash(item.TreeHash); err != nil {
+			return fmt.Errorf("fetch item %d (%s): invalid 'tree-hash': %w", index, item.Name, err)
 		}
 	}
 
@@ -143,28 +359,64 @@ func validateFetchItem(item FetchItem, index int) error {
 				return fmt.Errorf("fetch item %d: bin-file cannot be true when extract is true", index)
 			}
 		case string:
+			if item.Extract && !isLocalPath(binFile) {
+				return fmt.Errorf("fetch item %d (%s): bin-file %q escapes the extraction directory", index, item.Name, binFile)
+			}
+			if name := filepath.Base(binFile); name == "." || !filepath.IsLocal(name) {
+				return fmt.Errorf("fetch item %d (%s): invalid bin-file %q", index, item.Name, binFile)
+			}
 		default:
 			return fmt.Errorf("fetch item %d: bin-file must be a string or boolean", index)
 		}
 	}
 
+	if item.BinFiles != nil {
+		if item.BinFile != nil {
+			return fmt.Errorf("fetch item %d (%s): only one of 'bin-file' or 'bin-files' can be specified", index, item.Name)
+		}
+		if !item.Extract {
+			return fmt.Errorf("fetch item %d (%s): 'bin-files' requires extract to be true", index, item.Name)
+		}
+
+		links, err := item.GetBinLinks()
+		if err != nil {
+			return fmt.Errorf("fetch item %d (%s): invalid 'bin-files': %w", index, item.Name, err)
+		}
+		if len(links) == 0 {
+			return fmt.Errorf("fetch item %d (%s): invalid 'bin-files': no entries", index, item.Name)
+		}
+		for _, link := range links {
+			if !isLocalPath(link.Path) {
+				return fmt.Errorf("fetch item %d (%s): invalid 'bin-files[%s]': %q escapes the extraction directory", index, item.Name, link.Name, link.Path)
+			}
+			if link.Name == "." || filepath.Base(link.Name) != link.Name || !filepath.IsLocal(link.Name) {
+				return fmt.Errorf("fetch item %d (%s): invalid 'bin-files[%s]': link name must be a plain file name", index, item.Name, link.Name)
+			}
+		}
+	}
+
 	return nil
 }
 
-func validateHashFormat(hash string, validHashTypes []string, index int) error {
-	validHash := false
-	for _, hashType := range validHashTypes {
-		if strings.HasPrefix(hash, hashType) {
-			validHash = true
-			break
-		}
+func validateGlobs(patterns []string, field string, item FetchItem, index int) error {
+	if len(patterns) > 0 && !item.Extract {
+		return fmt.Errorf("fetch item %d (%s): '%s' requires extract to be true", index, item.Name, field)
 	}
-	if !validHash {
-		return fmt.Errorf("hash must be in format 'type:value' where type is one of: sha256, sha512, sha3, blake2b, blake2s, blake3")
+	for i, pattern := range patterns {
+		if err := validateGlob(pattern); err != nil {
+			return fmt.Errorf("fetch item %d (%s): invalid '%s[%d]': %w", index, item.Name, field, i, err)
+		}
 	}
 	return nil
 }
 
+// validateHashFormat checks that a hash names a supported type and that its
+// digest has the length and encoding that type requires.
+func validateHashFormat(hash string) error {
+	_, _, err := decodeHash(hash)
+	return err
+}
+
 func (item FetchItem) GetBinFileString() (string, bool) {
 	if item.BinFile == nil {
 		return "", false
@@ -183,6 +435,76 @@ func (item FetchItem) GetBinFileString() (string, bool) {
 	}
 }
 
+// BinLink is a symlink in the bin directory named Name, pointing at Path
+// inside the item.
+type BinLink struct {
+	Name string
+	Path string
+}
+
+// hasBinLinks reports whether the item installs anything in the bin directory.
+func (item FetchItem) hasBinLinks() bool {
+	_, binFile := item.GetBinFileString()
+	return binFile || item.BinFiles != nil || len(item.BinDirs) > 0
+}
+
+// GetBinLinks returns the bin symlinks of an item from either bin-file or
+// bin-files. A bin-files list names each link after the base name of its path;
+// a map gives the link names explicitly and is returned sorted by name.
+func (item FetchItem) GetBinLinks() ([]BinLink, error) {
+	if binFile, ok := item.GetBinFileString(); ok {
+		return []BinLink{{Name: filepath.Base(binFile), Path: binFile}}, nil
+	}
+
+	var links []BinLink
+	switch binFiles := item.BinFiles.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		for _, binFile := range binFiles {
+			links = append(links, BinLink{Name: filepath.Base(binFile), Path: binFile})
+		}
+	case []interface{}:
+		for i, value := range binFiles {
+			binFile, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("entry %d must be a string", i)
+			}
+			links = append(links, BinLink{Name: filepath.Base(binFile), Path: binFile})
+		}
+	case map[string]string:
+		for name, binFile := range binFiles {
+			links = append(links, BinLink{Name: name, Path: binFile})
+		}
+		sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+	case map[string]interface{}:
+		names := make([]string, 0, len(binFiles))
+		for name := range binFiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			binFile, ok := binFiles[name].(string)
+			if !ok {
+				return nil, fmt.Errorf("entry %q must be a string", name)
+			}
+			links = append(links, BinLink{Name: name, Path: binFile})
+		}
+	default:
+		return nil, fmt.Errorf("must be a list of paths or a map of link names to paths")
+	}
+
+	seen := make(map[string]bool)
+	for _, link := range links {
+		if seen[link.Name] {
+			return nil, fmt.Errorf("link name %q is used more than once, use a map to name the links", link.Name)
+		}
+		seen[link.Name] = true
+	}
+
+	return links, nil
+}
+
 func (item FetchItem) GetOutputDir(globalOutputDir string) string {
 	if item.OutputDir != "" {
 		return item.OutputDir
@@ -197,6 +519,12 @@ func (item FetchItem) GetBinDir(globalBinDir string) string {
 	return globalBinDir
 }
 
+// GetExtractLimits returns the item's extraction limits, with fields it
+// leaves unset taken from the global limits.
+func (item FetchItem) GetExtractLimits(globalLimits ExtractLimits) ExtractLimits {
+	return item.ExtractLimits.withDefaults(globalLimits)
+}
+
 func FilterFetchItems(config *Config, names []string) ([]FetchItem, error) {
 	if len(names) == 0 {
 		return config.Fetch, nil
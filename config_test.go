@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -82,6 +84,11 @@ func TestLoadConfigFileNotFound(t *testing.T) {
 	}
 }
 
+const (
+	testSHA256Hash = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	testSHA512Hash = "sha512:cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e"
+)
+
 func TestValidateConfig(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -89,176 +96,1180 @@ func TestValidateConfig(t *testing.T) {
 		expectError bool
 	}{
 		{
-			name: "valid config with single hash",
+			name: "valid config with single hash",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "valid config with multiple hashes",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hashes:  []string{testSHA256Hash, testSHA512Hash},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "empty fetch array",
+			config: Config{
+				Fetch: []FetchItem{},
+			},
+			expectError: true,
+		},
+		{
+			name: "missing name",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						URL:  "https://example.com/file.zip",
+						Hash: testSHA256Hash,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "missing URL",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name: "test",
+						Hash: testSHA256Hash,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "missing hash and hashes",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name: "test",
+						URL:  "https://example.com/file.zip",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "both hash and hashes provided",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:   "test",
+						URL:    "https://example.com/file.zip",
+						Hash:   testSHA256Hash,
+						Hashes: []string{testSHA512Hash},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid hash format",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name: "test",
+						URL:  "https://example.com/file.zip",
+						Hash: "invalid-hash",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-file true with extract true",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						BinFile: true,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-file string with extract true",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						BinFile: "binary",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "bin-file escaping extraction directory",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						BinFile: "../../etc/passwd",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-file with leading slash inside extraction directory",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						BinFile: "/package/bin/tool",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "version field contains $version placeholder",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/v$version/file.zip",
+						Version: "$version",
+						Hash:    testSHA256Hash,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "version field contains $VERSION placeholder",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/v$VERSION/file.zip",
+						Version: "v$VERSION",
+						Hash:    testSHA256Hash,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "version field contains both placeholders",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/v$version/file.zip",
+						Version: "$version-$VERSION",
+						Hash:    testSHA256Hash,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "truncated hash",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hash:    "sha256:abcd1234",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "truncated entry in hashes",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hashes:  []string{testSHA256Hash, "sha512:efgh5678"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "weak hash on its own",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hash:    "sha1:da39a3ee5e6b4b0d3255bfef95601890afd80709",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "only weak hashes",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hashes: []string{
+							"sha1:da39a3ee5e6b4b0d3255bfef95601890afd80709",
+							"md5:d41d8cd98f00b204e9800998ecf8427e",
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "weak hash next to strong hash",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hashes: []string{
+							testSHA256Hash,
+							"md5:d41d8cd98f00b204e9800998ecf8427e",
+						},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "valid file-hashes with extract",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:       "test",
+						URL:        "https://example.com/file.zip",
+						Version:    "1.0.0",
+						Hash:       testSHA256Hash,
+						Extract:    true,
+						FileHashes: map[string]string{"bin/tool": testSHA512Hash},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "file-hashes without extract",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:       "test",
+						URL:        "https://example.com/file.zip",
+						Version:    "1.0.0",
+						Hash:       testSHA256Hash,
+						FileHashes: map[string]string{"bin/tool": testSHA512Hash},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "file-hashes with invalid hash",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:       "test",
+						URL:        "https://example.com/file.zip",
+						Version:    "1.0.0",
+						Hash:       testSHA256Hash,
+						Extract:    true,
+						FileHashes: map[string]string{"bin/tool": "sha256:abcd1234"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "tree-hash without extract",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						TreeHash: "t1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "malformed tree-hash",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						TreeHash: "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid archive-type",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:        "test",
+						URL:         "https://example.com/download?id=42",
+						Version:     "1.0.0",
+						Hash:        testSHA256Hash,
+						Extract:     true,
+						ArchiveType: "tgz",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "archive-type without extract",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:        "test",
+						URL:         "https://example.com/download?id=42",
+						Version:     "1.0.0",
+						Hash:        testSHA256Hash,
+						ArchiveType: "tar.gz",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "unsupported archive-type",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:        "test",
+						URL:         "https://example.com/download?id=42",
+						Version:     "1.0.0",
+						Hash:        testSHA256Hash,
+						Extract:     true,
+						ArchiveType: "rar",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "strip-components without extract",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:            "test",
+						URL:             "https://example.com/file.tar.gz",
+						Version:         "1.0.0",
+						Hash:            testSHA256Hash,
+						StripComponents: 1,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "negative strip-components",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:            "test",
+						URL:             "https://example.com/file.tar.gz",
+						Version:         "1.0.0",
+						Hash:            testSHA256Hash,
+						Extract:         true,
+						StripComponents: -1,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid include and exclude",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.tar.gz",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						Include: []string{"bin/tool", "lib/**"},
+						Exclude: []string{"**/*.a"},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "include without extract",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.tar.gz",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						Include: []string{"bin/tool"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "malformed exclude pattern",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.tar.gz",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						Exclude: []string{"lib/[a-z"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "negative extract limit",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:          "test",
+						URL:           "https://example.com/file.tar.gz",
+						Version:       "1.0.0",
+						Hash:          testSHA256Hash,
+						Extract:       true,
+						ExtractLimits: ExtractLimits{MaxEntries: -1},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid extract-nested",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:          "test",
+						URL:           "https://example.com/bundle.zip",
+						Version:       "1.0.0",
+						Hash:          testSHA256Hash,
+						Extract:       true,
+						ExtractNested: []NestedArchive{{Path: "dist/tool.tar.gz", Hash: testSHA256Hash}},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "extract-nested without path",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:          "test",
+						URL:           "https://example.com/bundle.zip",
+						Version:       "1.0.0",
+						Hash:          testSHA256Hash,
+						Extract:       true,
+						ExtractNested: []NestedArchive{{Hash: testSHA256Hash}},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "extract-nested with weak hash",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:          "test",
+						URL:           "https://example.com/bundle.zip",
+						Version:       "1.0.0",
+						Hash:          testSHA256Hash,
+						Extract:       true,
+						ExtractNested: []NestedArchive{{Path: "dist/tool.tar.gz", Hash: "md5:d41d8cd98f00b204e9800998ecf8427e"}},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid decompress",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:        "test",
+						URL:         "https://example.com/tool.gz",
+						Version:     "1.0.0",
+						Hash:        testSHA256Hash,
+						Decompress:  true,
+						ArchiveType: "gz",
+						BinFile:     true,
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "decompress with extract",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:       "test",
+						URL:        "https://example.com/tool.gz",
+						Version:    "1.0.0",
+						Hash:       testSHA256Hash,
+						Extract:    true,
+						Decompress: true,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "decompress with archive archive-type",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:        "test",
+						URL:         "https://example.com/tool.tgz",
+						Version:     "1.0.0",
+						Hash:        testSHA256Hash,
+						Decompress:  true,
+						ArchiveType: "tar.gz",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid versioned item",
+			config: Config{
+				KeepVersions: 3,
+				Fetch: []FetchItem{
+					{
+						Name:         "test",
+						URL:          "https://example.com/tool-$version",
+						Version:      "1.0.0",
+						Hash:         testSHA256Hash,
+						Versioned:    true,
+						KeepVersions: 2,
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "versioned item without version",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:      "test",
+						URL:       "https://example.com/tool",
+						Hash:      testSHA256Hash,
+						Versioned: true,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "versioned item with path in version",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:      "test",
+						URL:       "https://example.com/tool",
+						Version:   "../1.0.0",
+						Hash:      testSHA256Hash,
+						Versioned: true,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "keep-versions without versioned",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:         "test",
+						URL:          "https://example.com/tool",
+						Version:      "1.0.0",
+						Hash:         testSHA256Hash,
+						KeepVersions: 2,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "negative global keep-versions",
+			config: Config{
+				KeepVersions: -1,
+				Fetch: []FetchItem{
+					{
+						Name: "test",
+						URL:  "https://example.com/tool",
+						Hash: testSHA256Hash,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files list",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: []interface{}{"go/bin/go", "go/bin/gofmt"},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "bin-files map",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: map[string]interface{}{"node": "bin/node", "npm": "bin/npm"},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "bin-files with bin-file",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFile:  "bin/node",
+						BinFiles: []interface{}{"bin/npm"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files without extract",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						BinFiles: []interface{}{"bin/npm"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files escaping extraction directory",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: []interface{}{"../../etc/passwd"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files duplicate link names",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: []interface{}{"a/bin/tool", "b/bin/tool"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files link name with separator",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: map[string]interface{}{"sub/tool": "bin/tool"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files link name dot",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: map[string]interface{}{".": "bin/tool"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files empty link name",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: map[string]interface{}{"": "bin/tool"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files list entry naming the directory",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: []interface{}{"."},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files non-string entry",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: []interface{}{"bin/tool", 1.0},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-files empty",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:     "test",
+						URL:      "https://example.com/file.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: []interface{}{},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin-dirs with filters",
 			config: Config{
 				Fetch: []FetchItem{
 					{
 						Name:    "test",
 						URL:     "https://example.com/file.zip",
 						Version: "1.0.0",
-						Hash:    "sha256:abcd1234",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						BinDirs: []BinDirectory{{Path: "jdk/bin", Include: []string{"j*"}, Exclude: []string{"jdb"}}},
 					},
 				},
 			},
 			expectError: false,
 		},
 		{
-			name: "valid config with multiple hashes",
+			name: "bin-dirs without extract",
 			config: Config{
 				Fetch: []FetchItem{
 					{
 						Name:    "test",
 						URL:     "https://example.com/file.zip",
 						Version: "1.0.0",
-						Hashes:  []string{"sha256:abcd1234", "sha512:efgh5678"},
+						Hash:    testSHA256Hash,
+						BinDirs: []BinDirectory{{Path: "bin"}},
 					},
 				},
 			},
-			expectError: false,
+			expectError: true,
 		},
 		{
-			name: "empty fetch array",
+			name: "bin-dirs without path",
 			config: Config{
-				Fetch: []FetchItem{},
+				Fetch: []FetchItem{
+					{
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						BinDirs: []BinDirectory{{Include: []string{"*"}}},
+					},
+				},
 			},
 			expectError: true,
 		},
 		{
-			name: "missing name",
+			name: "bin-dirs escaping extraction directory",
 			config: Config{
 				Fetch: []FetchItem{
 					{
-						URL:  "https://example.com/file.zip",
-						Hash: "sha256:abcd1234",
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						BinDirs: []BinDirectory{{Path: "../bin"}},
 					},
 				},
 			},
 			expectError: true,
 		},
 		{
-			name: "missing URL",
+			name: "bin-dirs malformed pattern",
 			config: Config{
 				Fetch: []FetchItem{
 					{
-						Name: "test",
-						Hash: "sha256:abcd1234",
+						Name:    "test",
+						URL:     "https://example.com/file.zip",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						Extract: true,
+						BinDirs: []BinDirectory{{Path: "bin", Exclude: []string{"[a"}}},
 					},
 				},
 			},
 			expectError: true,
 		},
 		{
-			name: "missing hash and hashes",
+			name: "valid bin-mode",
 			config: Config{
+				BinMode: "relative-symlink",
 				Fetch: []FetchItem{
 					{
-						Name: "test",
-						URL:  "https://example.com/file.zip",
+						Name:    "test",
+						URL:     "https://example.com/tool",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						BinMode: "copy",
 					},
 				},
 			},
-			expectError: true,
+			expectError: false,
 		},
 		{
-			name: "both hash and hashes provided",
+			name: "unknown global bin-mode",
 			config: Config{
+				BinMode: "junction",
 				Fetch: []FetchItem{
 					{
-						Name:   "test",
-						URL:    "https://example.com/file.zip",
-						Hash:   "sha256:abcd1234",
-						Hashes: []string{"sha512:efgh5678"},
+						Name:    "test",
+						URL:     "https://example.com/tool",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						BinFile: true,
 					},
 				},
 			},
 			expectError: true,
 		},
 		{
-			name: "invalid hash format",
+			name: "unknown item bin-mode",
 			config: Config{
 				Fetch: []FetchItem{
 					{
-						Name: "test",
-						URL:  "https://example.com/file.zip",
-						Hash: "invalid-hash",
+						Name:    "test",
+						URL:     "https://example.com/tool",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						BinMode: "junction",
 					},
 				},
 			},
 			expectError: true,
 		},
 		{
-			name: "bin-file true with extract true",
+			name: "bin-env with shim",
 			config: Config{
 				Fetch: []FetchItem{
 					{
 						Name:    "test",
-						URL:     "https://example.com/file.zip",
-						Hash:    "sha256:abcd1234",
-						Extract: true,
-						BinFile: true,
+						URL:     "https://example.com/tool",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						BinMode: "shim",
+						BinEnv:  map[string]string{"JAVA_HOME": "$item-dir"},
 					},
 				},
 			},
-			expectError: true,
+			expectError: false,
 		},
 		{
-			name: "bin-file string with extract true",
+			name: "bin-env with global shim",
 			config: Config{
+				BinMode: "shim",
 				Fetch: []FetchItem{
 					{
 						Name:    "test",
-						URL:     "https://example.com/file.zip",
+						URL:     "https://example.com/tool",
 						Version: "1.0.0",
-						Hash:    "sha256:abcd1234",
-						Extract: true,
-						BinFile: "binary",
+						Hash:    testSHA256Hash,
+						BinEnv:  map[string]string{"JAVA_HOME": "$item-dir"},
 					},
 				},
 			},
 			expectError: false,
 		},
 		{
-			name: "version field contains $version placeholder",
+			name: "bin-env without shim",
 			config: Config{
 				Fetch: []FetchItem{
 					{
 						Name:    "test",
-						URL:     "https://example.com/v$version/file.zip",
-						Version: "$version",
-						Hash:    "sha256:abcd1234",
+						URL:     "https://example.com/tool",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						BinEnv:  map[string]string{"JAVA_HOME": "$item-dir"},
 					},
 				},
 			},
 			expectError: true,
 		},
 		{
-			name: "version field contains $VERSION placeholder",
+			name: "bin-env invalid name",
 			config: Config{
 				Fetch: []FetchItem{
 					{
 						Name:    "test",
-						URL:     "https://example.com/v$VERSION/file.zip",
-						Version: "v$VERSION",
-						Hash:    "sha256:abcd1234",
+						URL:     "https://example.com/tool",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						BinMode: "shim",
+						BinEnv:  map[string]string{"JAVA-HOME": "/opt/jdk"},
 					},
 				},
 			},
 			expectError: true,
 		},
 		{
-			name: "version field contains both placeholders",
+			name: "name reserved for a subcommand",
 			config: Config{
 				Fetch: []FetchItem{
 					{
-						Name:    "test",
-						URL:     "https://example.com/v$version/file.zip",
-						Version: "$version-$VERSION",
-						Hash:    "sha256:abcd1234",
+						Name:    "verify",
+						URL:     "https://example.com/tool",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "bin link created by two items",
+			config: Config{
+				BinsDir: "/usr/local/bin",
+				Fetch: []FetchItem{
+					{
+						Name:    "tool-a",
+						URL:     "https://example.com/tool-a",
+						Version: "1.0.0",
+						Hash:    testSHA256Hash,
+						BinFile: "tool",
+					},
+					{
+						Name:     "tool-b",
+						URL:      "https://example.com/tool-b.zip",
+						Version:  "1.0.0",
+						Hash:     testSHA256Hash,
+						Extract:  true,
+						BinFiles: []interface{}{"bin/tool"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "versioned with hardlink bin-mode",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:      "test",
+						URL:       "https://example.com/file",
+						Version:   "1.0.0",
+						Hash:      testSHA256Hash,
+						Versioned: true,
+						BinFile:   true,
+						BinMode:   binModeHardlink,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "versioned with copy bin-mode",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:      "test",
+						URL:       "https://example.com/file",
+						Version:   "1.0.0",
+						Hash:      testSHA256Hash,
+						Versioned: true,
+						BinFile:   true,
+						BinMode:   binModeCopy,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "versioned with global copy bin-mode",
+			config: Config{
+				BinMode: binModeCopy,
+				Fetch: []FetchItem{
+					{
+						Name:      "test",
+						URL:       "https://example.com/file",
+						Version:   "1.0.0",
+						Hash:      testSHA256Hash,
+						Versioned: true,
+						BinFile:   true,
 					},
 				},
 			},
 			expectError: true,
 		},
+		{
+			name: "versioned with shim bin-mode",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:      "test",
+						URL:       "https://example.com/file",
+						Version:   "1.0.0",
+						Hash:      testSHA256Hash,
+						Versioned: true,
+						BinFile:   true,
+						BinMode:   binModeShim,
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "versioned with relative-symlink bin-mode",
+			config: Config{
+				Fetch: []FetchItem{
+					{
+						Name:      "test",
+						URL:       "https://example.com/file",
+						Version:   "1.0.0",
+						Hash:      testSHA256Hash,
+						Versioned: true,
+						BinFile:   true,
+						BinMode:   binModeRelativeSymlink,
+					},
+				},
+			},
+			expectError: false,
+		},
 		{
 			name: "valid version field with placeholder in URL",
 			config: Config{
@@ -267,7 +1278,7 @@ func TestValidateConfig(t *testing.T) {
 						Name:    "test",
 						URL:     "https://example.com/v$version/file.zip",
 						Version: "1.2.3",
-						Hash:    "sha256:abcd1234",
+						Hash:    testSHA256Hash,
 					},
 				},
 			},
@@ -292,8 +1303,6 @@ func TestValidateConfig(t *testing.T) {
 }
 
 func TestValidateHashFormat(t *testing.T) {
-	validHashTypes := []string{"sha256:", "sha512:", "sha3:", "blake2b:", "blake2s:", "blake3:"}
-
 	tests := []struct {
 		name        string
 		hash        string
@@ -301,42 +1310,112 @@ func TestValidateHashFormat(t *testing.T) {
 	}{
 		{
 			name:        "valid sha256",
-			hash:        "sha256:abcd1234",
+			hash:        testSHA256Hash,
 			expectError: false,
 		},
 		{
 			name:        "valid sha512",
-			hash:        "sha512:efgh5678",
+			hash:        testSHA512Hash,
 			expectError: false,
 		},
 		{
 			name:        "valid sha3",
-			hash:        "sha3:ijkl9012",
+			hash:        "sha3:a7ffc6f8bf1ed76651c14756a061d662f580ff4de43b49fa82d80a4b80f8434a",
 			expectError: false,
 		},
 		{
 			name:        "valid blake2b",
-			hash:        "blake2b:mnop3456",
+			hash:        "blake2b:0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8",
 			expectError: false,
 		},
 		{
 			name:        "valid blake2s",
-			hash:        "blake2s:qrst7890",
+			hash:        "blake2s:69217a3079908094e11121d042354a7c1f55b6482ca1a51e1b250dfd1ed0eef9",
+			expectError: false,
+		},
+		{
+			name:        "valid sha384",
+			hash:        "sha384:38b060a751ac96384cd9327eb1b1e36a21fdb71114be07434c0cc7bf63f6e1da274edebfe76f65fbd51ad2f14898b95b",
+			expectError: false,
+		},
+		{
+			name:        "valid sha512/256",
+			hash:        "sha512/256:c672b8d1ef56ed28ab87c3622c5114069bdd3ad7b8f9737498d0c01ecef0967a",
+			expectError: false,
+		},
+		{
+			name:        "valid sha3-512",
+			hash:        "sha3-512:a69f73cca23a9ac5c8b567dc185a756e97c982164fe25859e0d1dcc1475c80a615b2123af1f5f94c11e3e9402c3ac558f500199d95b6d3e301758586281dcd26",
+			expectError: false,
+		},
+		{
+			name:        "valid blake2b-512",
+			hash:        "blake2b-512:786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce",
+			expectError: false,
+		},
+		{
+			name:        "valid sha384 SRI",
+			hash:        "sha384-OLBgp1GsljhM2TJ+sbHjaiH9txEUvgdDTAzHv2P24donTt6/529l+9Ua0vFImLlb",
+			expectError: false,
+		},
+		{
+			name:        "valid md5 format",
+			hash:        "md5:d41d8cd98f00b204e9800998ecf8427e",
+			expectError: false,
+		},
+		{
+			name:        "valid uppercase hex",
+			hash:        "sha256:E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855",
+			expectError: false,
+		},
+		{
+			name:        "valid base64",
+			hash:        "sha256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
 			expectError: false,
 		},
 		{
-			name:        "valid blake3",
-			hash:        "blake3:uvwx1234",
+			name:        "valid sha512 SRI",
+			hash:        "sha512-z4PhNX7vuL3xVChQ1m2AB9Yg5AULVxXcg/SpIdNs6c5H0NE8XYXysP+DGNKHfuwvY7kxvUdBeoGlODJ6+SfaPg==",
 			expectError: false,
 		},
+		{
+			name:        "invalid SRI algorithm",
+			hash:        "md5-1B2M2Y8AsgTpgAmY7PhCfg==",
+			expectError: true,
+		},
+		{
+			name:        "truncated hex",
+			hash:        "sha256:e3b0c44298fc1c149afbf4c8996fb924",
+			expectError: true,
+		},
+		{
+			name:        "sha256 length for sha512",
+			hash:        "sha512:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			expectError: true,
+		},
+		{
+			name:        "non-hex characters",
+			hash:        "sha256:g3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			expectError: true,
+		},
+		{
+			name:        "empty digest",
+			hash:        "sha256:",
+			expectError: true,
+		},
+		{
+			name:        "unsupported blake3",
+			hash:        "blake3:af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262",
+			expectError: true,
+		},
 		{
 			name:        "invalid hash type",
-			hash:        "md5:abcd1234",
+			hash:        "crc32:00000000",
 			expectError: true,
 		},
 		{
 			name:        "no colon separator",
-			hash:        "sha256abcd1234",
+			hash:        "sha256e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
 			expectError: true,
 		},
 		{
@@ -348,7 +1427,7 @@ func TestValidateHashFormat(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateHashFormat(tt.hash, validHashTypes, 0)
+			err := validateHashFormat(tt.hash)
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("Expected error, but got none")
@@ -362,6 +1441,26 @@ func TestValidateHashFormat(t *testing.T) {
 	}
 }
 
+func TestValidateFetchItemHashErrorNamesField(t *testing.T) {
+	item := FetchItem{
+		Name:    "tool",
+		URL:     "https://example.com/file.zip",
+		Version: "1.0.0",
+		Hashes:  []string{testSHA256Hash, "sha256:abcd1234"},
+	}
+
+	err := validateFetchItem(item, 3)
+	if err == nil {
+		t.Fatalf("Expected error, but got none")
+	}
+
+	for _, want := range []string{"fetch item 3", "tool", "hashes[1]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %q", want, err.Error())
+		}
+	}
+}
+
 func TestFetchItem_GetBinFileString(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -428,6 +1527,74 @@ func TestFetchItem_GetBinFileString(t *testing.T) {
 	}
 }
 
+func TestFetchItem_GetBinLinks(t *testing.T) {
+	tests := []struct {
+		name          string
+		item          FetchItem
+		expectedLinks []BinLink
+		expectError   bool
+	}{
+		{
+			name: "no bin files",
+			item: FetchItem{Name: "tool"},
+		},
+		{
+			name: "bin-file true",
+			item: FetchItem{Name: "tool", BinFile: true},
+			expectedLinks: []BinLink{
+				{Name: "tool", Path: "tool"},
+			},
+		},
+		{
+			name: "bin-file path",
+			item: FetchItem{Name: "go", BinFile: "go/bin/go"},
+			expectedLinks: []BinLink{
+				{Name: "go", Path: "go/bin/go"},
+			},
+		},
+		{
+			name: "bin-files list keeps order",
+			item: FetchItem{Name: "go", BinFiles: []interface{}{"go/bin/gofmt", "go/bin/go"}},
+			expectedLinks: []BinLink{
+				{Name: "gofmt", Path: "go/bin/gofmt"},
+				{Name: "go", Path: "go/bin/go"},
+			},
+		},
+		{
+			name: "bin-files map sorted by link name",
+			item: FetchItem{Name: "node", BinFiles: map[string]interface{}{"npx": "bin/npx", "node": "bin/node", "npm": "bin/npm"}},
+			expectedLinks: []BinLink{
+				{Name: "node", Path: "bin/node"},
+				{Name: "npm", Path: "bin/npm"},
+				{Name: "npx", Path: "bin/npx"},
+			},
+		},
+		{
+			name:        "bin-files wrong type",
+			item:        FetchItem{Name: "tool", BinFiles: "bin/tool"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, err := tt.item.GetBinLinks()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(links, tt.expectedLinks) {
+				t.Errorf("Expected links %v, got %v", tt.expectedLinks, links)
+			}
+		})
+	}
+}
+
 func TestFetchItem_GetOutputDir(t *testing.T) {
 	tests := []struct {
 		name              string
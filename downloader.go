@@ -1,13 +1,19 @@
 package main
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
 
 	"golang.org/x/crypto/blake2b"
@@ -61,98 +67,251 @@ func getFilenameFromURL(url_ string) (string, error) {
 	return filename, nil
 }
 
-func verifySHA256(data []byte, hash string) error {
-	hasher := sha256.New()
-	hasher.Write(data)
-	actualHash := fmt.Sprintf("%x", hasher.Sum(nil))
-
-	if actualHash != hash {
-		return fmt.Errorf("hash mismatch: expected %s, got %s", hash, actualHash)
+// compareDigest checks a computed digest against the expected one in constant
+// time.
+func compareDigest(actual, expected []byte) error {
+	if subtle.ConstantTimeCompare(actual, expected) != 1 {
+		return fmt.Errorf("hash mismatch: expected %x, got %x", expected, actual)
 	}
 
 	return nil
 }
 
-func verifySHA512(data []byte, hash string) error {
-	hasher := sha512.New()
+func verifySHA256(data []byte, expected []byte) error {
+	hasher := sha256.New()
 	hasher.Write(data)
-	actualHash := fmt.Sprintf("%x", hasher.Sum(nil))
-
-	if actualHash != hash {
-		return fmt.Errorf("hash mismatch: expected %s, got %s", hash, actualHash)
-	}
+	return compareDigest(hasher.Sum(nil), expected)
+}
 
-	return nil
+func verifySHA512(data []byte, expected []byte) error {
+	hasher := sha512.New()
+	hasher.Write(data)
+	return compareDigest(hasher.Sum(nil), expected)
 }
 
-func verifySHA3(data []byte, hash string) error {
+func verifySHA3(data []byte, expected []byte) error {
 	hasher := sha3.New256()
 	hasher.Write(data)
-	actualHash := fmt.Sprintf("%x", hasher.Sum(nil))
-
-	if actualHash != hash {
-		return fmt.Errorf("hash mismatch: expected %s, got %s", hash, actualHash)
-	}
-
-	return nil
+	return compareDigest(hasher.Sum(nil), expected)
 }
 
-func verifyBLAKE2b(data []byte, hash string) error {
+func verifyBLAKE2b(data []byte, expected []byte) error {
 	hasher, err := blake2b.New256(nil)
 	if err != nil {
 		return fmt.Errorf("failed to create BLAKE2b hasher: %w", err)
 	}
 	hasher.Write(data)
-	actualHash := fmt.Sprintf("%x", hasher.Sum(nil))
+	return compareDigest(hasher.Sum(nil), expected)
+}
 
-	if actualHash != hash {
-		return fmt.Errorf("hash mismatch: expected %s, got %s", hash, actualHash)
+func verifyBLAKE2s(data []byte, expected []byte) error {
+	hasher, err := blake2s.New256(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create BLAKE2s hasher: %w", err)
 	}
+	hasher.Write(data)
+	return compareDigest(hasher.Sum(nil), expected)
+}
 
-	return nil
+func verifySHA384(data []byte, expected []byte) error {
+	hasher := sha512.New384()
+	hasher.Write(data)
+	return compareDigest(hasher.Sum(nil), expected)
 }
 
-func verifyBLAKE2s(data []byte, hash string) error {
-	hasher, err := blake2s.New256(nil)
+func verifySHA512_256(data []byte, expected []byte) error {
+	hasher := sha512.New512_256()
+	hasher.Write(data)
+	return compareDigest(hasher.Sum(nil), expected)
+}
+
+func verifySHA3_512(data []byte, expected []byte) error {
+	hasher := sha3.New512()
+	hasher.Write(data)
+	return compareDigest(hasher.Sum(nil), expected)
+}
+
+func verifyBLAKE2b512(data []byte, expected []byte) error {
+	hasher, err := blake2b.New512(nil)
 	if err != nil {
-		return fmt.Errorf("failed to create BLAKE2s hasher: %w", err)
+		return fmt.Errorf("failed to create BLAKE2b-512 hasher: %w", err)
 	}
 	hasher.Write(data)
-	actualHash := fmt.Sprintf("%x", hasher.Sum(nil))
+	return compareDigest(hasher.Sum(nil), expected)
+}
+
+func verifySHA1(data []byte, expected []byte) error {
+	hasher := sha1.New()
+	hasher.Write(data)
+	return compareDigest(hasher.Sum(nil), expected)
+}
+
+func verifyMD5(data []byte, expected []byte) error {
+	hasher := md5.New()
+	hasher.Write(data)
+	return compareDigest(hasher.Sum(nil), expected)
+}
+
+type hashAlgorithm struct {
+	// size is the digest length in bytes
+	size int
+	// weak algorithms are only accepted as extra checks next to a strong one
+	weak   bool
+	verify func(data, expected []byte) error
+}
 
-	if actualHash != hash {
-		return fmt.Errorf("hash mismatch: expected %s, got %s", hash, actualHash)
+// hashAlgorithms is the registry of supported hash types.
+var hashAlgorithms = map[string]hashAlgorithm{
+	"sha256":      {size: sha256.Size, verify: verifySHA256},
+	"sha384":      {size: sha512.Size384, verify: verifySHA384},
+	"sha512":      {size: sha512.Size, verify: verifySHA512},
+	"sha512/256":  {size: sha512.Size256, verify: verifySHA512_256},
+	"sha3":        {size: 32, verify: verifySHA3},
+	"sha3-256":    {size: 32, verify: verifySHA3},
+	"sha3-512":    {size: 64, verify: verifySHA3_512},
+	"blake2b":     {size: blake2b.Size256, verify: verifyBLAKE2b},
+	"blake2b-256": {size: blake2b.Size256, verify: verifyBLAKE2b},
+	"blake2b-512": {size: blake2b.Size, verify: verifyBLAKE2b512},
+	"blake2s":     {size: blake2s.Size, verify: verifyBLAKE2s},
+	"sha1":        {size: sha1.Size, weak: true, verify: verifySHA1},
+	"md5":         {size: md5.Size, weak: true, verify: verifyMD5},
+}
+
+// sriHashTypes maps Subresource Integrity algorithm prefixes to hash types.
+var sriHashTypes = map[string]string{
+	"sha256": "sha256",
+	"sha384": "sha384",
+	"sha512": "sha512",
+}
+
+// parseSRIHash splits an SRI string such as "sha512-<base64>" into its hash
+// type and digest. Any "?options" suffix allowed by the SRI spec is dropped.
+func parseSRIHash(hash string) (string, string, bool) {
+	prefix, value, found := strings.Cut(hash, "-")
+	if !found {
+		return "", "", false
 	}
 
-	return nil
+	hashType, ok := sriHashTypes[prefix]
+	if !ok {
+		return "", "", false
+	}
+
+	value, _, _ = strings.Cut(value, "?")
+	return hashType, value, true
 }
 
-func VerifyHash(data []byte, expectedHash string) error {
-	parts := strings.Split(expectedHash, ":")
+func parseHash(expectedHash string) (string, string, error) {
+	// HTML integrity attributes may list several space-separated entries
+	if len(strings.Fields(expectedHash)) > 1 {
+		return "", "", fmt.Errorf("hash %q holds multiple SRI hashes, list each one in 'hashes' instead", expectedHash)
+	}
+
+	if hashType, hashValue, ok := parseSRIHash(expectedHash); ok {
+		return hashType, hashValue, nil
+	}
 
+	parts := strings.Split(expectedHash, ":")
 	if len(parts) != 2 {
-		return fmt.Errorf("invalid hash format: %s", expectedHash)
+		return "", "", fmt.Errorf("invalid hash format %q, expected 'type:value' or 'type-base64'", expectedHash)
 	}
 
-	hashType := parts[0]
-	hashValue := parts[1]
+	return parts[0], parts[1], nil
+}
+
+// decodeDigest decodes a digest given as hex (any case), base64 or base64url,
+// requiring exactly size bytes.
+func decodeDigest(hashType, value string, size int) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("%s digest is empty", hashType)
+	}
 
-	switch hashType {
-	case "sha256":
-		return verifySHA256(data, hashValue)
-	case "sha512":
-		return verifySHA512(data, hashValue)
-	case "sha3":
-		return verifySHA3(data, hashValue)
-	case "blake2b":
-		return verifyBLAKE2b(data, hashValue)
-	case "blake2s":
-		return verifyBLAKE2s(data, hashValue)
-	default:
-		return fmt.Errorf("unsupported hash type: %s", hashType)
+	if digest, err := hex.DecodeString(value); err == nil {
+		if len(digest) == size {
+			return digest, nil
+		}
+		return nil, fmt.Errorf("%s digest must be %d hex characters, got %d", hashType, hex.EncodedLen(size), len(value))
 	}
+
+	encodings := []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	}
+	for _, encoding := range encodings {
+		digest, err := encoding.DecodeString(value)
+		if err == nil && len(digest) == size {
+			return digest, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s digest %q is neither %d hex characters nor a base64 encoding of %d bytes", hashType, value, hex.EncodedLen(size), size)
 }
 
+func supportedHashTypes() []string {
+	hashTypes := make([]string, 0, len(hashAlgorithms))
+	for hashType := range hashAlgorithms {
+		hashTypes = append(hashTypes, hashType)
+	}
+	sort.Strings(hashTypes)
+	return hashTypes
+}
+
+// decodeHash parses an expected hash in any accepted notation and returns its
+// hash type and raw digest, checking the digest length for that type.
+func decodeHash(expectedHash string) (string, []byte, error) {
+	hashType, hashValue, err := parseHash(expectedHash)
+	if err != nil {
+		return "", nil, err
+	}
+
+	algorithm, ok := hashAlgorithms[hashType]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported hash type %q, must be one of: %s", hashType, strings.Join(supportedHashTypes(), ", "))
+	}
+
+	digest, err := decodeDigest(hashType, hashValue, algorithm.size)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return hashType, digest, nil
+}
+
+// isWeakHash reports whether hash uses an algorithm that may only serve as an
+// extra check next to a strong one.
+func isWeakHash(hash string) bool {
+	hashType, _, err := parseHash(hash)
+	if err != nil {
+		return false
+	}
+	return hashAlgorithms[hashType].weak
+}
+
+// verifyDigest checks data against expectedHash without regard to algorithm
+// strength, returning the algorithm used.
+func verifyDigest(data []byte, expectedHash string) (hashAlgorithm, error) {
+	hashType, digest, err := decodeHash(expectedHash)
+	if err != nil {
+		return hashAlgorithm{}, err
+	}
+
+	algorithm := hashAlgorithms[hashType]
+	return algorithm, algorithm.verify(data, digest)
+}
+
+func VerifyHash(data []byte, expectedHash string) error {
+	if isWeakHash(expectedHash) {
+		return fmt.Errorf("weak hash %s cannot be used on its own, list it in 'hashes' next to a strong hash", expectedHash)
+	}
+
+	_, err := verifyDigest(data, expectedHash)
+	return err
+}
+
+// VerifyHashes succeeds when at least one strong hash matches. Weak hashes
+// are extra checks: every one of them must match as well.
 func VerifyHashes(data []byte, expectedHashes []string) error {
 	if len(expectedHashes) == 0 {
 		return fmt.Errorf("no hashes provided for verification")
@@ -162,14 +321,21 @@ func VerifyHashes(data []byte, expectedHashes []string) error {
 	verified := false
 
 	for _, expectedHash := range expectedHashes {
-		if err := VerifyHash(data, expectedHash); err != nil {
+		algorithm, err := verifyDigest(data, expectedHash)
+		if err != nil {
+			if algorithm.weak {
+				return fmt.Errorf("legacy hash %s failed: %w", expectedHash, err)
+			}
 			errors = append(errors, fmt.Sprintf("hash %s failed: %v", expectedHash, err))
-		} else {
+		} else if !algorithm.weak {
 			verified = true
 		}
 	}
 
 	if !verified {
+		if len(errors) == 0 {
+			return fmt.Errorf("no strong hash provided, weak hashes can only be used next to a strong one")
+		}
 		return fmt.Errorf("all hash verifications failed:\n%s", strings.Join(errors, "\n"))
 	}
 
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"golang.org/x/crypto/blake2b"
@@ -113,7 +118,8 @@ func TestVerifySHA256(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := verifySHA256(tt.data, tt.hash)
+			expected, _ := hex.DecodeString(tt.hash)
+			err := verifySHA256(tt.data, expected)
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("Expected error, but got none")
@@ -155,7 +161,8 @@ func TestVerifySHA512(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := verifySHA512(tt.data, tt.hash)
+			expected, _ := hex.DecodeString(tt.hash)
+			err := verifySHA512(tt.data, expected)
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("Expected error, but got none")
@@ -197,7 +204,8 @@ func TestVerifySHA3(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := verifySHA3(tt.data, tt.hash)
+			expected, _ := hex.DecodeString(tt.hash)
+			err := verifySHA3(tt.data, expected)
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("Expected error, but got none")
@@ -239,7 +247,8 @@ func TestVerifyBLAKE2b(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := verifyBLAKE2b(tt.data, tt.hash)
+			expected, _ := hex.DecodeString(tt.hash)
+			err := verifyBLAKE2b(tt.data, expected)
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("Expected error, but got none")
@@ -281,7 +290,8 @@ func TestVerifyBLAKE2s(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := verifyBLAKE2s(tt.data, tt.hash)
+			expected, _ := hex.DecodeString(tt.hash)
+			err := verifyBLAKE2s(tt.data, expected)
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("Expected error, but got none")
@@ -300,7 +310,12 @@ func TestVerifyHash(t *testing.T) {
 
 	sha256Hasher := sha256.New()
 	sha256Hasher.Write(testData)
-	sha256Hash := fmt.Sprintf("%x", sha256Hasher.Sum(nil))
+	sha256Sum := sha256Hasher.Sum(nil)
+	sha256Hash := fmt.Sprintf("%x", sha256Sum)
+
+	sha512Hasher := sha512.New()
+	sha512Hasher.Write(testData)
+	sha512Sum := sha512Hasher.Sum(nil)
 
 	tests := []struct {
 		name         string
@@ -314,6 +329,42 @@ func TestVerifyHash(t *testing.T) {
 			expectedHash: "sha256:" + sha256Hash,
 			expectError:  false,
 		},
+		{
+			name:         "valid sha256 base64 hash",
+			data:         testData,
+			expectedHash: "sha256:" + base64.StdEncoding.EncodeToString(sha256Sum),
+			expectError:  false,
+		},
+		{
+			name:         "valid sha512 unpadded base64url hash",
+			data:         testData,
+			expectedHash: "sha512:" + base64.RawURLEncoding.EncodeToString(sha512Sum),
+			expectError:  false,
+		},
+		{
+			name:         "valid sha512 SRI hash",
+			data:         testData,
+			expectedHash: "sha512-" + base64.StdEncoding.EncodeToString(sha512Sum),
+			expectError:  false,
+		},
+		{
+			name:         "valid sha256 SRI hash with options",
+			data:         testData,
+			expectedHash: "sha256-" + base64.StdEncoding.EncodeToString(sha256Sum) + "?ct=application/octet-stream",
+			expectError:  false,
+		},
+		{
+			name:         "wrong SRI hash",
+			data:         testData,
+			expectedHash: "sha512-" + base64.StdEncoding.EncodeToString(sha256Sum),
+			expectError:  true,
+		},
+		{
+			name:         "unsupported SRI algorithm",
+			data:         testData,
+			expectedHash: "md5-" + base64.StdEncoding.EncodeToString(sha256Sum),
+			expectError:  true,
+		},
 		{
 			name:         "invalid hash format",
 			data:         testData,
@@ -332,6 +383,18 @@ func TestVerifyHash(t *testing.T) {
 			expectedHash: "sha256:wronghash",
 			expectError:  true,
 		},
+		{
+			name:         "valid uppercase sha256 hash",
+			data:         testData,
+			expectedHash: "sha256:" + strings.ToUpper(sha256Hash),
+			expectError:  false,
+		},
+		{
+			name:         "truncated sha256 hash",
+			data:         testData,
+			expectedHash: "sha256:" + sha256Hash[:32],
+			expectError:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -350,6 +413,84 @@ func TestVerifyHash(t *testing.T) {
 	}
 }
 
+func TestVerifyHashMultipleSRI(t *testing.T) {
+	testData := []byte("test data")
+	sha384Sum := sha512.Sum384(testData)
+	sha512Sum := sha512.Sum512(testData)
+	integrity := "sha384-" + base64.StdEncoding.EncodeToString(sha384Sum[:]) + " sha512-" + base64.StdEncoding.EncodeToString(sha512Sum[:])
+
+	err := VerifyHash(testData, integrity)
+	if err == nil {
+		t.Fatalf("Expected error for multiple SRI hashes, but got none")
+	}
+	if !strings.Contains(err.Error(), "multiple SRI hashes") || !strings.Contains(err.Error(), "'hashes'") {
+		t.Errorf("Expected error to point to 'hashes', got: %v", err)
+	}
+
+	if err := validateHashFormat(integrity); err == nil {
+		t.Errorf("Expected config validation to reject multiple SRI hashes")
+	}
+}
+
+func TestVerifyHashAlgorithms(t *testing.T) {
+	testData := []byte("test data")
+
+	blake2b512 := blake2b.Sum512(testData)
+
+	tests := []struct {
+		hashType string
+		digest   []byte
+	}{
+		{hashType: "sha384", digest: sha512Sum384(testData)},
+		{hashType: "sha512/256", digest: sha512Sum512_256(testData)},
+		{hashType: "sha3-256", digest: sha3Sum256(testData)},
+		{hashType: "sha3-512", digest: sha3Sum512(testData)},
+		{hashType: "blake2b-512", digest: blake2b512[:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hashType, func(t *testing.T) {
+			if err := VerifyHash(testData, fmt.Sprintf("%s:%x", tt.hashType, tt.digest)); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			wrongDigest := make([]byte, len(tt.digest))
+			if err := VerifyHash(testData, fmt.Sprintf("%s:%x", tt.hashType, wrongDigest)); err == nil {
+				t.Errorf("Expected error for wrong digest, but got none")
+			}
+		})
+	}
+}
+
+func sha512Sum384(data []byte) []byte {
+	sum := sha512.Sum384(data)
+	return sum[:]
+}
+
+func sha512Sum512_256(data []byte) []byte {
+	sum := sha512.Sum512_256(data)
+	return sum[:]
+}
+
+func sha3Sum256(data []byte) []byte {
+	sum := sha3.Sum256(data)
+	return sum[:]
+}
+
+func sha3Sum512(data []byte) []byte {
+	sum := sha3.Sum512(data)
+	return sum[:]
+}
+
+func TestVerifyHashWeakAlone(t *testing.T) {
+	testData := []byte("test data")
+	sha1Hash := fmt.Sprintf("sha1:%x", sha1.Sum(testData))
+
+	if err := VerifyHash(testData, sha1Hash); err == nil {
+		t.Errorf("Expected error for weak hash used on its own, but got none")
+	}
+}
+
 func TestVerifyHashes(t *testing.T) {
 	testData := []byte("test data")
 
@@ -361,6 +502,9 @@ func TestVerifyHashes(t *testing.T) {
 	sha512Hasher.Write(testData)
 	sha512Hash := fmt.Sprintf("%x", sha512Hasher.Sum(nil))
 
+	md5Hash := fmt.Sprintf("md5:%x", md5.Sum(testData))
+	sha1Hash := fmt.Sprintf("sha1:%x", sha1.Sum(testData))
+
 	tests := []struct {
 		name           string
 		data           []byte
@@ -385,6 +529,30 @@ func TestVerifyHashes(t *testing.T) {
 			expectedHashes: []string{"sha256:wronghash1", "sha512:wronghash2"},
 			expectError:    true,
 		},
+		{
+			name:           "strong and weak hashes correct",
+			data:           testData,
+			expectedHashes: []string{"sha256:" + sha256Hash, md5Hash, sha1Hash},
+			expectError:    false,
+		},
+		{
+			name:           "weak hash wrong next to correct strong hash",
+			data:           testData,
+			expectedHashes: []string{"sha256:" + sha256Hash, "md5:d41d8cd98f00b204e9800998ecf8427e"},
+			expectError:    true,
+		},
+		{
+			name:           "weak hash correct next to wrong strong hash",
+			data:           testData,
+			expectedHashes: []string{"sha256:" + sha256Hash[:62] + "00", md5Hash},
+			expectError:    true,
+		},
+		{
+			name:           "only weak hashes",
+			data:           testData,
+			expectedHashes: []string{md5Hash, sha1Hash},
+			expectError:    true,
+		},
 		{
 			name:           "empty hashes array",
 			data:           testData,
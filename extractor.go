@@ -4,92 +4,444 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
 	"fmt"
 	"io"
+	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
+// fileModeMask keeps the permission bits an archive entry may carry over to
+// the written file.
+const fileModeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
 type ExtractedFile struct {
 	Name string
 	Data []byte
+	// Mode holds the permission bits from the archive, zero when unknown
+	Mode os.FileMode
+	// Symlink is the link target when the entry is a symbolic link
+	Symlink string
+	// Hardlink names the earlier entry this one is a hard link to. Data and
+	// Mode are copied from that entry.
+	Hardlink string
+	// ModTime is the modification time from the archive, zero when unknown
+	ModTime time.Time
 }
 
 type ExtractionResult struct {
 	Files []ExtractedFile
+	// Skipped counts the entries left out by the include/exclude filters
+	Skipped int
+}
+
+// cleanArchivePath normalizes an archive entry name to a slash-separated
+// relative path, e.g. "./bin//tool" becomes "bin/tool".
+func cleanArchivePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// sanitizeArchivePath validates an archive entry name and returns it cleaned.
+// Absolute names and names that would escape the extraction directory are
+// rejected.
+func sanitizeArchivePath(name string) (string, error) {
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("absolute path %q is not allowed", name)
+	}
+
+	cleaned := path.Clean(name)
+	if !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+		return "", fmt.Errorf("path %q escapes the extraction directory", name)
+	}
+
+	return cleaned, nil
+}
+
+// validateSymlinkTarget checks that a symlink entry resolves inside the
+// extraction directory. Targets must be relative, and ".." may only appear
+// as leading elements so the kernel resolves them the same way path.Join does.
+func validateSymlinkTarget(name, target string) error {
+	if target == "" {
+		return fmt.Errorf("symlink %q has an empty target", name)
+	}
+
+	if strings.HasPrefix(target, "/") || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return fmt.Errorf("symlink %q has absolute target %q", name, target)
+	}
+
+	seenName := false
+	for _, element := range strings.Split(target, "/") {
+		switch element {
+		case "", ".":
+		case "..":
+			if seenName {
+				return fmt.Errorf("symlink %q has target %q with '..' after a path element", name, target)
+			}
+		default:
+			seenName = true
+		}
+	}
+
+	resolved := path.Join(path.Dir(name), target)
+	if !filepath.IsLocal(filepath.FromSlash(resolved)) {
+		return fmt.Errorf("symlink %q -> %q escapes the extraction directory", name, target)
+	}
+
+	return nil
+}
+
+// archiveLinks tracks link entries while an archive is read. Entries may not
+// be placed at or below a symlink, so nothing is ever written through one,
+// and hard links may only point to regular files seen earlier.
+type archiveLinks struct {
+	files    map[string]ExtractedFile
+	symlinks map[string]bool
+	// hardlinked holds hard links and their targets, which share one file once
+	// written, so a later entry of the same name would change both
+	hardlinked map[string]bool
+	// rootedSymlinks treats absolute symlink targets as relative to the
+	// extraction directory, as packages are meant to be unpacked at "/"
+	rootedSymlinks bool
 }
 
-func ExtractArchive(data []byte, filename string) (*ExtractionResult, error) {
-	ext := strings.ToLower(filepath.Ext(filename))
+func newArchiveLinks() *archiveLinks {
+	return &archiveLinks{
+		files:      make(map[string]ExtractedFile),
+		symlinks:   make(map[string]bool),
+		hardlinked: make(map[string]bool),
+	}
+}
 
-	switch ext {
-	case ".zip":
-		return extractZip(data)
-	case ".gz":
-		if strings.HasSuffix(strings.ToLower(filename), ".tar.gz") {
-			return extractTarGz(data)
+func (links *archiveLinks) checkNotThroughSymlink(name string) error {
+	for prefix := name; prefix != "."; prefix = path.Dir(prefix) {
+		if links.symlinks[prefix] {
+			return fmt.Errorf("entry %q would be written through symlink %q", name, prefix)
 		}
-		return extractGzip(data, filename)
-	case ".tgz":
-		return extractTarGz(data)
-	case ".tar":
-		return extractTar(data)
+	}
+	return nil
+}
+
+func (links *archiveLinks) addFile(file ExtractedFile) error {
+	if err := links.checkNotThroughSymlink(file.Name); err != nil {
+		return err
+	}
+	if links.hardlinked[file.Name] {
+		return fmt.Errorf("entry %q replaces an earlier hard-linked entry", file.Name)
+	}
+	links.files[file.Name] = file
+	return nil
+}
+
+func (links *archiveLinks) addSymlink(name, target string) (ExtractedFile, error) {
+	if err := links.checkNotThroughSymlink(name); err != nil {
+		return ExtractedFile{}, err
+	}
+	if links.rootedSymlinks && strings.HasPrefix(target, "/") {
+		target = rootedSymlinkTarget(name, target)
+	}
+	if err := validateSymlinkTarget(name, target); err != nil {
+		return ExtractedFile{}, err
+	}
+	if _, exists := links.files[name]; exists {
+		return ExtractedFile{}, fmt.Errorf("symlink %q replaces an earlier entry", name)
+	}
+
+	links.symlinks[name] = true
+	return ExtractedFile{Name: name, Symlink: target}, nil
+}
+
+// rootedSymlinkTarget rewrites an absolute target as a path relative to the
+// directory of the link, e.g. "/usr/lib/tool" for "usr/bin/tool" becomes
+// "../../usr/lib/tool".
+func rootedSymlinkTarget(name, target string) string {
+	dirElements := strings.Split(path.Dir(name), "/")
+	if dirElements[0] == "." {
+		dirElements = nil
+	}
+
+	var up []string
+	for range dirElements {
+		up = append(up, "..")
+	}
+
+	relative := path.Join(append(up, cleanArchivePath(target))...)
+	if relative == "" {
+		return "."
+	}
+	return relative
+}
+
+func (links *archiveLinks) addHardlink(name, target string) (ExtractedFile, error) {
+	target, err := sanitizeArchivePath(target)
+	if err != nil {
+		return ExtractedFile{}, fmt.Errorf("hard link %q: %w", name, err)
+	}
+
+	targetFile, ok := links.files[target]
+	if !ok {
+		return ExtractedFile{}, fmt.Errorf("hard link %q points to %q, which is not an earlier regular file", name, target)
+	}
+	if _, exists := links.files[name]; exists {
+		return ExtractedFile{}, fmt.Errorf("hard link %q replaces an earlier entry", name)
+	}
+
+	file := ExtractedFile{
+		Name:     name,
+		Data:     targetFile.Data,
+		Mode:     targetFile.Mode,
+		Hardlink: target,
+		ModTime:  targetFile.ModTime,
+	}
+	if err := links.addFile(file); err != nil {
+		return ExtractedFile{}, err
+	}
+	links.hardlinked[name] = true
+	links.hardlinked[target] = true
+
+	return file, nil
+}
+
+// ExtractOptions controls how ExtractArchive reads an archive.
+type ExtractOptions struct {
+	// ArchiveType overrides the format hint taken from the file extension
+	ArchiveType string
+	// StripComponents removes this many leading path elements from each entry
+	StripComponents int
+	// Include, when set, keeps only entries matching one of its globs
+	Include []string
+	// Exclude drops entries matching one of its globs
+	Exclude []string
+	// Limits bounds the size and number of entries, zero fields use defaults
+	Limits ExtractLimits
+}
+
+func ExtractArchive(data []byte, filename string, opts ExtractOptions) (*ExtractionResult, error) {
+	format, err := detectArchiveFormat(data, filename, opts.ArchiveType)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *ExtractionResult
+	switch format {
+	case "zip":
+		result, err = extractZip(data, opts.Limits)
+	case "tar":
+		result, err = extractTar(data, opts.Limits)
+	case "tar.gz":
+		result, err = extractTarGz(data, opts.Limits)
+	case "gz":
+		result, err = extractGzip(data, filename, opts.Limits)
+	case "tar.xz":
+		result, err = extractTarXz(data, opts.Limits)
+	case "xz":
+		result, err = extractXz(data, filename, opts.Limits)
+	case "tar.zst":
+		result, err = extractTarZst(data, opts.Limits)
+	case "zst":
+		result, err = extractZst(data, filename, opts.Limits)
+	case "tar.bz2":
+		result, err = extractTarBz2(data, opts.Limits)
+	case "bz2":
+		result, err = extractBz2(data, filename, opts.Limits)
+	case "deb":
+		result, err = extractDeb(data, opts.Limits)
+	case "rpm":
+		result, err = extractRpm(data, opts.Limits)
 	default:
-		return nil, fmt.Errorf("unsupported archive format: %s", ext)
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.StripComponents > 0 {
+		files, err := stripComponents(result.Files, opts.StripComponents)
+		if err != nil {
+			return nil, fmt.Errorf("strip-components %d: %w", opts.StripComponents, err)
+		}
+		result.Files = files
+	}
+
+	if len(opts.Include) > 0 || len(opts.Exclude) > 0 {
+		result.Files, result.Skipped, err = filterFiles(result.Files, opts.Include, opts.Exclude, newExtractBudget(opts.Limits, len(data)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// filterFiles applies include and exclude globs to the extracted entries and
+// returns the kept entries with the number skipped. Hard links whose target
+// was skipped keep their copied data and are written as regular files, so the
+// files that will be written are charged to budget again.
+func filterFiles(files []ExtractedFile, include, exclude []string, budget *extractBudget) ([]ExtractedFile, int, error) {
+	kept := make([]ExtractedFile, 0, len(files))
+	keptNames := make(map[string]bool, len(files))
+
+	for _, file := range files {
+		if len(include) > 0 && !matchAnyGlob(include, file.Name) {
+			continue
+		}
+		if matchAnyGlob(exclude, file.Name) {
+			continue
+		}
+
+		if file.Hardlink != "" && !keptNames[file.Hardlink] {
+			file.Hardlink = ""
+		}
+		if file.Symlink == "" && file.Hardlink == "" {
+			if err := budget.charge(file.Name, int64(len(file.Data))); err != nil {
+				return nil, 0, fmt.Errorf("filtered archive over limit: %w", err)
+			}
+		}
+
+		kept = append(kept, file)
+		keptNames[file.Name] = true
+	}
+
+	return kept, len(files) - len(kept), nil
+}
+
+// stripPath removes count leading elements from a cleaned archive path and
+// reports false when nothing would be left.
+func stripPath(name string, count int) (string, bool) {
+	parts := strings.SplitN(name, "/", count+1)
+	if len(parts) <= count {
+		return "", false
+	}
+	return parts[count], true
+}
+
+// stripComponents removes count leading path elements from every entry, like
+// tar's --strip-components. Unlike tar it refuses to silently drop files that
+// sit above the stripped depth or to let two entries land on the same path.
+// Link entries are checked again against their new location.
+func stripComponents(files []ExtractedFile, count int) ([]ExtractedFile, error) {
+	stripped := make([]ExtractedFile, 0, len(files))
+	origins := make(map[string]string, len(files))
+	links := newArchiveLinks()
+
+	for _, file := range files {
+		name, ok := stripPath(file.Name, count)
+		if !ok {
+			return nil, fmt.Errorf("entry %q has fewer than %d leading directories and would be dropped", file.Name, count)
+		}
+		if origin, exists := origins[name]; exists {
+			return nil, fmt.Errorf("entries %q and %q would both become %q", origin, file.Name, name)
+		}
+		origins[name] = file.Name
+
+		var strippedFile ExtractedFile
+		var err error
+		switch {
+		case file.Symlink != "":
+			strippedFile, err = links.addSymlink(name, file.Symlink)
+		case file.Hardlink != "":
+			target, ok := stripPath(file.Hardlink, count)
+			if !ok {
+				return nil, fmt.Errorf("hard link %q points to %q, which would be dropped", file.Name, file.Hardlink)
+			}
+			strippedFile, err = links.addHardlink(name, target)
+		default:
+			strippedFile = file
+			strippedFile.Name = name
+			err = links.addFile(strippedFile)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		stripped = append(stripped, strippedFile)
+	}
+
+	// A file may not take the place of a directory another entry needs
+	for _, file := range stripped {
+		for dir := path.Dir(file.Name); dir != "."; dir = path.Dir(dir) {
+			if origin, exists := origins[dir]; exists {
+				return nil, fmt.Errorf("entry %q would become %q, which is a directory of %q", origin, dir, origins[file.Name])
+			}
+		}
 	}
+
+	return stripped, nil
 }
 
-func extractZip(data []byte) (*ExtractionResult, error) {
+func extractZip(data []byte, limits ExtractLimits) (*ExtractionResult, error) {
 	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open zip archive: %w", err)
 	}
 
 	var files []ExtractedFile
+	links := newArchiveLinks()
+	budget := newExtractBudget(limits, len(data))
 
 	for _, file := range reader.File {
+		if err := budget.addEntry(); err != nil {
+			return nil, fmt.Errorf("zip archive over limit: %w", err)
+		}
 		if file.FileInfo().IsDir() {
 			continue
 		}
 
+		name, err := sanitizeArchivePath(file.Name)
+		if err != nil {
+			return nil, fmt.Errorf("unsafe entry in zip archive: %w", err)
+		}
+
 		rc, err := file.Open()
 		if err != nil {
 			return nil, fmt.Errorf("failed to open file %s in zip: %w", file.Name, err)
 		}
 
-		fileData, err := io.ReadAll(rc)
+		fileData, err := budget.readEntry(file.Name, rc)
 		rc.Close()
 		if err != nil {
 			return nil, fmt.Errorf("failed to read file %s from zip: %w", file.Name, err)
 		}
 
-		files = append(files, ExtractedFile{
-			Name: file.Name,
-			Data: fileData,
-		})
+		// Zip archives created on Unix store symlinks with the target as content
+		if file.Mode()&os.ModeSymlink != 0 {
+			symlink, err := links.addSymlink(name, string(fileData))
+			if err != nil {
+				return nil, fmt.Errorf("unsafe entry in zip archive: %w", err)
+			}
+			files = append(files, symlink)
+			continue
+		}
+
+		extractedFile := ExtractedFile{
+			Name:    name,
+			Data:    fileData,
+			Mode:    file.Mode() & fileModeMask,
+			ModTime: file.Modified,
+		}
+		if err := links.addFile(extractedFile); err != nil {
+			return nil, fmt.Errorf("unsafe entry in zip archive: %w", err)
+		}
+		files = append(files, extractedFile)
 	}
 
 	return &ExtractionResult{Files: files}, nil
 }
 
-func extractTarGz(data []byte) (*ExtractionResult, error) {
-	gzReader, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("failed to open gzip reader: %w", err)
-	}
-	defer gzReader.Close()
-
-	decompressed, err := io.ReadAll(gzReader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decompress gzip data: %w", err)
-	}
-
-	return extractTar(decompressed)
+func extractTar(data []byte, limits ExtractLimits) (*ExtractionResult, error) {
+	return readTar(bytes.NewReader(data), newExtractBudget(limits, len(data)), newArchiveLinks())
 }
 
-func extractTar(data []byte) (*ExtractionResult, error) {
-	tarReader := tar.NewReader(bytes.NewReader(data))
+// readTar extracts a tar stream entry by entry, so compressed archives are
+// never decompressed as a whole into memory.
+func readTar(r io.Reader, budget *extractBudget, links *archiveLinks) (*ExtractionResult, error) {
+	tarReader := tar.NewReader(r)
 
 	var files []ExtractedFile
 
@@ -101,38 +453,206 @@ func extractTar(data []byte) (*ExtractionResult, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to read tar header: %w", err)
 		}
+		if err := budget.addEntry(); err != nil {
+			return nil, fmt.Errorf("tar archive over limit: %w", err)
+		}
 
-		if header.Typeflag != tar.TypeReg {
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeSymlink, tar.TypeLink:
+		default:
 			continue
 		}
 
-		fileData, err := io.ReadAll(tarReader)
+		name, err := sanitizeArchivePath(header.Name)
+		if err != nil {
+			return nil, fmt.Errorf("unsafe entry in tar archive: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			symlink, err := links.addSymlink(name, header.Linkname)
+			if err != nil {
+				return nil, fmt.Errorf("unsafe entry in tar archive: %w", err)
+			}
+			files = append(files, symlink)
+			continue
+		case tar.TypeLink:
+			hardlink, err := links.addHardlink(name, header.Linkname)
+			if err != nil {
+				return nil, fmt.Errorf("unsafe entry in tar archive: %w", err)
+			}
+			files = append(files, hardlink)
+			continue
+		}
+
+		fileData, err := budget.readEntry(header.Name, tarReader)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read file %s from tar: %w", header.Name, err)
 		}
 
-		files = append(files, ExtractedFile{
-			Name: header.Name,
-			Data: fileData,
-		})
+		extractedFile := ExtractedFile{
+			Name:    name,
+			Data:    fileData,
+			Mode:    header.FileInfo().Mode() & fileModeMask,
+			ModTime: header.ModTime,
+		}
+		if err := links.addFile(extractedFile); err != nil {
+			return nil, fmt.Errorf("unsafe entry in tar archive: %w", err)
+		}
+		files = append(files, extractedFile)
 	}
 
 	return &ExtractionResult{Files: files}, nil
 }
 
-func extractGzip(data []byte, filename string) (*ExtractionResult, error) {
-	gzReader, err := gzip.NewReader(bytes.NewReader(data))
+func extractTarGz(data []byte, limits ExtractLimits) (*ExtractionResult, error) {
+	return extractCompressedTar("gz", data, limits)
+}
+
+func extractGzip(data []byte, filename string, limits ExtractLimits) (*ExtractionResult, error) {
+	return extractCompressedFile("gz", data, filename, limits)
+}
+
+func extractTarXz(data []byte, limits ExtractLimits) (*ExtractionResult, error) {
+	return extractCompressedTar("xz", data, limits)
+}
+
+func extractXz(data []byte, filename string, limits ExtractLimits) (*ExtractionResult, error) {
+	return extractCompressedFile("xz", data, filename, limits)
+}
+
+func extractTarZst(data []byte, limits ExtractLimits) (*ExtractionResult, error) {
+	return extractCompressedTar("zst", data, limits)
+}
+
+func extractZst(data []byte, filename string, limits ExtractLimits) (*ExtractionResult, error) {
+	return extractCompressedFile("zst", data, filename, limits)
+}
+
+func extractTarBz2(data []byte, limits ExtractLimits) (*ExtractionResult, error) {
+	return extractCompressedTar("bz2", data, limits)
+}
+
+func extractBz2(data []byte, filename string, limits ExtractLimits) (*ExtractionResult, error) {
+	return extractCompressedFile("bz2", data, filename, limits)
+}
+
+func extractCompressedTar(compression string, data []byte, limits ExtractLimits) (*ExtractionResult, error) {
+	reader, err := openDecompressor(compression, bytes.NewReader(data))
 	if err != nil {
-		return nil, fmt.Errorf("failed to open gzip reader: %w", err)
+		return nil, fmt.Errorf("failed to open %s reader: %w", compressionNames[compression], err)
 	}
-	defer gzReader.Close()
+	defer reader.Close()
+
+	return readTar(reader, newExtractBudget(limits, len(data)), newArchiveLinks())
+}
+
+// extractCompressedFile decompresses a single compressed file, named after
+// the download with the compression extension removed.
+func extractCompressedFile(compression string, data []byte, filename string, limits ExtractLimits) (*ExtractionResult, error) {
+	name := compressionNames[compression]
 
-	decompressed, err := io.ReadAll(gzReader)
+	reader, err := openDecompressor(compression, bytes.NewReader(data))
 	if err != nil {
-		return nil, fmt.Errorf("failed to decompress gzip data: %w", err)
+		return nil, fmt.Errorf("failed to open %s reader: %w", name, err)
 	}
+	defer reader.Close()
 
-	outputName := strings.TrimSuffix(filename, ".gz")
+	decompressed, err := newExtractBudget(limits, len(data)).readEntry(filename, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s data: %w", name, err)
+	}
+
+	result := singleFileResult(decompressed, filename, "."+compression)
+	// Only gzip records the modification time of the compressed file
+	if gzipReader, ok := reader.(*gzip.Reader); ok {
+		result.Files[0].ModTime = gzipReader.ModTime
+	}
+	return result, nil
+}
+
+// zstdMaxWindow caps the window size a zstd frame may request. It covers
+// archives made with "zstd --long=27" while refusing crafted frames that ask
+// for gigabytes of decoder memory.
+const zstdMaxWindow = 128 << 20
+
+var compressionNames = map[string]string{
+	"gz":  "gzip",
+	"xz":  "xz",
+	"zst": "zstd",
+	"bz2": "bzip2",
+}
+
+// openDecompressor returns a streaming reader for the given compression
+// format ("gz", "xz", "zst" or "bz2").
+func openDecompressor(compression string, r io.Reader) (io.ReadCloser, error) {
+	switch compression {
+	case "gz":
+		return gzip.NewReader(r)
+	case "xz":
+		// The xz decoder allocates each block's dictionary up front, so the
+		// sizes are checked before any decoding starts
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkXzDictSizes(data); err != nil {
+			return nil, err
+		}
+		xzReader, err := xz.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xzReader), nil
+	case "zst":
+		zstReader, err := zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxWindow(zstdMaxWindow),
+			zstd.WithDecoderMaxMemory(zstdMaxWindow),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return zstReader.IOReadCloser(), nil
+	case "bz2":
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+// DecompressFile decompresses a single gzip, xz, zstd or bzip2 compressed
+// file. The compression is taken from the content; archiveType, when set,
+// must agree with it.
+func DecompressFile(data []byte, filename, archiveType string, limits ExtractLimits) (ExtractedFile, error) {
+	compression := sniffFormat(data)
+	if compressionNames[compression] == "" {
+		return ExtractedFile{}, fmt.Errorf("%s is not gzip, xz, zstd or bzip2 compressed", filename)
+	}
+
+	if archiveType != "" {
+		format, err := normalizeArchiveType(archiveType)
+		if err != nil {
+			return ExtractedFile{}, err
+		}
+		if format != compression {
+			return ExtractedFile{}, fmt.Errorf("archive format mismatch: archive-type %q suggests %s, but the content is %s", archiveType, format, compression)
+		}
+	}
+
+	result, err := extractCompressedFile(compression, data, filename, limits)
+	if err != nil {
+		return ExtractedFile{}, err
+	}
+
+	return result.Files[0], nil
+}
+
+// singleFileResult wraps a decompressed stream as a single file named after
+// the download with the compression extension removed.
+func singleFileResult(decompressed []byte, filename, ext string) *ExtractionResult {
+	outputName := strings.TrimSuffix(filename, ext)
 	if outputName == filename {
 		outputName = "decompressed_file"
 	}
@@ -144,5 +664,5 @@ func extractGzip(data []byte, filename string) (*ExtractionResult, error) {
 				Data: decompressed,
 			},
 		},
-	}, nil
-}
\ No newline at end of file
+	}
+}
@@ -5,7 +5,14 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
 	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
 func TestExtractArchive(t *testing.T) {
@@ -39,6 +46,51 @@ func TestExtractArchive(t *testing.T) {
 			filename:    "file.gz",
 			expectError: false,
 		},
+		{
+			name:        "tar.xz file",
+			filename:    "file.tar.xz",
+			expectError: false,
+		},
+		{
+			name:        "txz file",
+			filename:    "file.txz",
+			expectError: false,
+		},
+		{
+			name:        "xz file",
+			filename:    "file.xz",
+			expectError: false,
+		},
+		{
+			name:        "tar.zst file",
+			filename:    "file.tar.zst",
+			expectError: false,
+		},
+		{
+			name:        "tzst file",
+			filename:    "file.tzst",
+			expectError: false,
+		},
+		{
+			name:        "zst file",
+			filename:    "file.zst",
+			expectError: false,
+		},
+		{
+			name:        "tar.bz2 file",
+			filename:    "file.tar.bz2",
+			expectError: false,
+		},
+		{
+			name:        "tbz2 file",
+			filename:    "file.tbz2",
+			expectError: false,
+		},
+		{
+			name:        "bz2 file",
+			filename:    "file.bz2",
+			expectError: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -55,6 +107,18 @@ func TestExtractArchive(t *testing.T) {
 				testData, err = createTestTar()
 			case tt.filename == "file.gz":
 				testData, err = createTestGzip()
+			case tt.filename == "file.tar.xz" || tt.filename == "file.txz":
+				testData, err = createTestTarXz()
+			case tt.filename == "file.xz":
+				testData, err = createTestXz()
+			case tt.filename == "file.tar.zst" || tt.filename == "file.tzst":
+				testData, err = createTestTarZst()
+			case tt.filename == "file.zst":
+				testData, err = createTestZst()
+			case tt.filename == "file.tar.bz2" || tt.filename == "file.tbz2":
+				testData = testTarBz2Data
+			case tt.filename == "file.bz2":
+				testData = testBz2Data
 			default:
 				testData = []byte("invalid data")
 			}
@@ -63,7 +127,7 @@ func TestExtractArchive(t *testing.T) {
 				t.Fatalf("Failed to create test data: %v", err)
 			}
 
-			result, err := ExtractArchive(testData, tt.filename)
+			result, err := ExtractArchive(testData, tt.filename, ExtractOptions{})
 
 			if tt.expectError {
 				if err == nil {
@@ -95,7 +159,7 @@ func TestExtractZip(t *testing.T) {
 		t.Fatalf("Failed to create test zip: %v", err)
 	}
 
-	result, err := extractZip(zipData)
+	result, err := extractZip(zipData, ExtractLimits{})
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -123,7 +187,7 @@ func TestExtractZip(t *testing.T) {
 
 func TestExtractZipInvalidData(t *testing.T) {
 	invalidData := []byte("not a zip file")
-	_, err := extractZip(invalidData)
+	_, err := extractZip(invalidData, ExtractLimits{})
 	if err == nil {
 		t.Errorf("Expected error for invalid zip data, but got none")
 	}
@@ -135,7 +199,7 @@ func TestExtractTar(t *testing.T) {
 		t.Fatalf("Failed to create test tar: %v", err)
 	}
 
-	result, err := extractTar(tarData)
+	result, err := extractTar(tarData, ExtractLimits{})
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -167,7 +231,7 @@ func TestExtractTarGz(t *testing.T) {
 		t.Fatalf("Failed to create test tar.gz: %v", err)
 	}
 
-	result, err := extractTarGz(tarGzData)
+	result, err := extractTarGz(tarGzData, ExtractLimits{})
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -195,7 +259,7 @@ func TestExtractGzip(t *testing.T) {
 		t.Fatalf("Failed to create test gzip: %v", err)
 	}
 
-	result, err := extractGzip(gzipData, "testfile.txt.gz")
+	result, err := extractGzip(gzipData, "testfile.txt.gz", ExtractLimits{})
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -223,7 +287,7 @@ func TestExtractGzip(t *testing.T) {
 
 func TestExtractGzipInvalidData(t *testing.T) {
 	invalidData := []byte("not gzip data")
-	_, err := extractGzip(invalidData, "test.gz")
+	_, err := extractGzip(invalidData, "test.gz", ExtractLimits{})
 	if err == nil {
 		t.Errorf("Expected error for invalid gzip data, but got none")
 	}
@@ -235,7 +299,279 @@ func TestExtractGzipFallbackFilename(t *testing.T) {
 		t.Fatalf("Failed to create test gzip: %v", err)
 	}
 
-	result, err := extractGzip(gzipData, "notgzfile")
+	result, err := extractGzip(gzipData, "notgzfile", ExtractLimits{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if result.Files[0].Name != "decompressed_file" {
+		t.Errorf("Expected fallback filename 'decompressed_file', got %q", result.Files[0].Name)
+	}
+}
+
+func TestExtractTarXz(t *testing.T) {
+	tarXzData, err := createTestTarXz()
+	if err != nil {
+		t.Fatalf("Failed to create test tar.xz: %v", err)
+	}
+
+	result, err := extractTarXz(tarXzData, ExtractLimits{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if result == nil {
+		t.Errorf("Expected result, but got nil")
+		return
+	}
+
+	if len(result.Files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(result.Files))
+		return
+	}
+
+	expectedContent := "test file content"
+	if string(result.Files[0].Data) != expectedContent {
+		t.Errorf("Expected content %q, got %q", expectedContent, string(result.Files[0].Data))
+	}
+}
+
+func TestExtractXz(t *testing.T) {
+	xzData, err := createTestXz()
+	if err != nil {
+		t.Fatalf("Failed to create test xz: %v", err)
+	}
+
+	result, err := extractXz(xzData, "testfile.txt.xz", ExtractLimits{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if result == nil {
+		t.Errorf("Expected result, but got nil")
+		return
+	}
+
+	if len(result.Files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(result.Files))
+		return
+	}
+
+	expectedContent := "test file content"
+	if string(result.Files[0].Data) != expectedContent {
+		t.Errorf("Expected content %q, got %q", expectedContent, string(result.Files[0].Data))
+	}
+
+	if result.Files[0].Name != "testfile.txt" {
+		t.Errorf("Expected filename 'testfile.txt', got %q", result.Files[0].Name)
+	}
+}
+
+func TestExtractXzInvalidData(t *testing.T) {
+	invalidData := []byte("not xz data")
+	_, err := extractXz(invalidData, "test.xz", ExtractLimits{})
+	if err == nil {
+		t.Errorf("Expected error for invalid xz data, but got none")
+	}
+}
+
+func TestExtractXzFallbackFilename(t *testing.T) {
+	xzData, err := createTestXz()
+	if err != nil {
+		t.Fatalf("Failed to create test xz: %v", err)
+	}
+
+	result, err := extractXz(xzData, "notxzfile", ExtractLimits{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if result.Files[0].Name != "decompressed_file" {
+		t.Errorf("Expected fallback filename 'decompressed_file', got %q", result.Files[0].Name)
+	}
+}
+
+func TestExtractTarZst(t *testing.T) {
+	tarZstData, err := createTestTarZst()
+	if err != nil {
+		t.Fatalf("Failed to create test tar.zst: %v", err)
+	}
+
+	result, err := extractTarZst(tarZstData, ExtractLimits{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if result == nil {
+		t.Errorf("Expected result, but got nil")
+		return
+	}
+
+	if len(result.Files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(result.Files))
+		return
+	}
+
+	expectedContent := "test file content"
+	if string(result.Files[0].Data) != expectedContent {
+		t.Errorf("Expected content %q, got %q", expectedContent, string(result.Files[0].Data))
+	}
+}
+
+func TestExtractZst(t *testing.T) {
+	zstData, err := createTestZst()
+	if err != nil {
+		t.Fatalf("Failed to create test zst: %v", err)
+	}
+
+	result, err := extractZst(zstData, "testfile.txt.zst", ExtractLimits{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if len(result.Files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(result.Files))
+		return
+	}
+
+	expectedContent := "test file content"
+	if string(result.Files[0].Data) != expectedContent {
+		t.Errorf("Expected content %q, got %q", expectedContent, string(result.Files[0].Data))
+	}
+
+	if result.Files[0].Name != "testfile.txt" {
+		t.Errorf("Expected filename 'testfile.txt', got %q", result.Files[0].Name)
+	}
+}
+
+func TestExtractZstInvalidData(t *testing.T) {
+	invalidData := []byte("not zstd data")
+	_, err := extractZst(invalidData, "test.zst", ExtractLimits{})
+	if err == nil {
+		t.Errorf("Expected error for invalid zstd data, but got none")
+	}
+}
+
+func TestExtractXzRejectsHugeDictionary(t *testing.T) {
+	// Stream with no check whose only block asks for a 4 GiB LZMA2 dictionary
+	stream := []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00, 0x00}
+	stream = binary.LittleEndian.AppendUint32(stream, crc32.ChecksumIEEE(stream[6:8]))
+
+	blockHeader := []byte{
+		0x02,       // header size: (2 + 1) * 4 bytes
+		0x00,       // one filter, no sizes
+		0x21, 0x01, // LZMA2 filter with one property byte
+		40, // dictionary size code for 4 GiB - 1
+		0x00, 0x00, 0x00,
+	}
+	stream = append(stream, blockHeader...)
+	stream = binary.LittleEndian.AppendUint32(stream, crc32.ChecksumIEEE(blockHeader))
+	stream = append(stream,
+		0x01, 0x00, 0x00, 'x', // uncompressed chunk of 1 byte
+		0x00,             // end of LZMA2 data
+		0x00, 0x00, 0x00, // block padding
+	)
+
+	index := []byte{0x00, 0x01, 0x11, 0x01} // one block of 17 bytes unpadded, 1 byte uncompressed
+	stream = append(stream, index...)
+	stream = binary.LittleEndian.AppendUint32(stream, crc32.ChecksumIEEE(index))
+
+	footer := binary.LittleEndian.AppendUint32(nil, 1) // backward size: (1 + 1) * 4 bytes
+	footer = append(footer, 0x00, 0x00)
+	stream = binary.LittleEndian.AppendUint32(stream, crc32.ChecksumIEEE(footer))
+	stream = append(stream, footer...)
+	stream = append(stream, 'Y', 'Z')
+
+	if _, err := extractXz(stream, "huge.xz", ExtractLimits{}); err == nil {
+		t.Errorf("Expected error for oversized xz dictionary, but got none")
+	}
+}
+
+func TestExtractZstRejectsHugeWindow(t *testing.T) {
+	// Frame header asking for a 1 GiB window, followed by a single raw block
+	frame := []byte{
+		0x28, 0xb5, 0x2f, 0xfd, // magic
+		0x00,             // frame header descriptor: window descriptor present
+		0xa0,             // window descriptor: 1 << (10 + 20) bytes
+		0x09, 0x00, 0x00, // last raw block of 1 byte
+		'x',
+	}
+
+	if _, err := extractZst(frame, "huge.zst", ExtractLimits{}); err == nil {
+		t.Errorf("Expected error for oversized zstd window, but got none")
+	}
+}
+
+func TestExtractTarBz2(t *testing.T) {
+	result, err := extractTarBz2(testTarBz2Data, ExtractLimits{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if result == nil {
+		t.Errorf("Expected result, but got nil")
+		return
+	}
+
+	if len(result.Files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(result.Files))
+		return
+	}
+
+	expectedContent := "test file content"
+	if string(result.Files[0].Data) != expectedContent {
+		t.Errorf("Expected content %q, got %q", expectedContent, string(result.Files[0].Data))
+	}
+
+	if result.Files[0].Name != "testfile.txt" {
+		t.Errorf("Expected filename 'testfile.txt', got %q", result.Files[0].Name)
+	}
+}
+
+func TestExtractBz2(t *testing.T) {
+	result, err := extractBz2(testBz2Data, "testfile.txt.bz2", ExtractLimits{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if result == nil {
+		t.Errorf("Expected result, but got nil")
+		return
+	}
+
+	if len(result.Files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(result.Files))
+		return
+	}
+
+	expectedContent := "test file content"
+	if string(result.Files[0].Data) != expectedContent {
+		t.Errorf("Expected content %q, got %q", expectedContent, string(result.Files[0].Data))
+	}
+
+	if result.Files[0].Name != "testfile.txt" {
+		t.Errorf("Expected filename 'testfile.txt', got %q", result.Files[0].Name)
+	}
+}
+
+func TestExtractBz2InvalidData(t *testing.T) {
+	invalidData := []byte("not bzip2 data")
+	_, err := extractBz2(invalidData, "test.bz2", ExtractLimits{})
+	if err == nil {
+		t.Errorf("Expected error for invalid bzip2 data, but got none")
+	}
+}
+
+func TestExtractBz2FallbackFilename(t *testing.T) {
+	result, err := extractBz2(testBz2Data, "notbz2file", ExtractLimits{})
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -246,6 +582,330 @@ func TestExtractGzipFallbackFilename(t *testing.T) {
 	}
 }
 
+func TestSanitizeArchivePath(t *testing.T) {
+	tests := []struct {
+		name        string
+		entry       string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "plain path",
+			entry:    "bin/tool",
+			expected: "bin/tool",
+		},
+		{
+			name:     "dot prefix and duplicate slashes",
+			entry:    "./bin//tool",
+			expected: "bin/tool",
+		},
+		{
+			name:     "dot-dot inside root",
+			entry:    "bin/../lib/tool",
+			expected: "lib/tool",
+		},
+		{
+			name:        "parent traversal",
+			entry:       "../../.bashrc",
+			expectError: true,
+		},
+		{
+			name:        "traversal after subdirectory",
+			entry:       "bin/../../escape",
+			expectError: true,
+		},
+		{
+			name:        "absolute path",
+			entry:       "/etc/passwd",
+			expectError: true,
+		},
+		{
+			name:        "dot-dot only",
+			entry:       "..",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := sanitizeArchivePath(tt.entry)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestExtractRejectsPathTraversal(t *testing.T) {
+	entries := []string{"../../.bashrc", "/etc/passwd", "safe/../../escape"}
+
+	for _, entry := range entries {
+		t.Run("zip "+entry, func(t *testing.T) {
+			var buf bytes.Buffer
+			zipWriter := zip.NewWriter(&buf)
+			file, err := zipWriter.Create(entry)
+			if err != nil {
+				t.Fatalf("Failed to create zip entry: %v", err)
+			}
+			file.Write([]byte("evil"))
+			zipWriter.Close()
+
+			if _, err := extractZip(buf.Bytes(), ExtractLimits{}); err == nil {
+				t.Errorf("Expected error for zip entry %q, but got none", entry)
+			}
+		})
+
+		t.Run("tar "+entry, func(t *testing.T) {
+			var buf bytes.Buffer
+			tarWriter := tar.NewWriter(&buf)
+			tarWriter.WriteHeader(&tar.Header{Name: entry, Mode: 0644, Size: 4})
+			tarWriter.Write([]byte("evil"))
+			tarWriter.Close()
+
+			if _, err := extractTar(buf.Bytes(), ExtractLimits{}); err == nil {
+				t.Errorf("Expected error for tar entry %q, but got none", entry)
+			}
+		})
+	}
+}
+
+func TestExtractPreservesModes(t *testing.T) {
+	t.Run("tar", func(t *testing.T) {
+		var buf bytes.Buffer
+		tarWriter := tar.NewWriter(&buf)
+		entries := []struct {
+			name string
+			mode int64
+		}{
+			{name: "bin/tool", mode: 0755},
+			{name: "lib/data", mode: 0644},
+			{name: "bin/helper", mode: 04755},
+		}
+		for _, entry := range entries {
+			tarWriter.WriteHeader(&tar.Header{Name: entry.name, Mode: entry.mode, Size: 1, Typeflag: tar.TypeReg})
+			tarWriter.Write([]byte("x"))
+		}
+		tarWriter.Close()
+
+		result, err := extractTar(buf.Bytes(), ExtractLimits{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]os.FileMode{
+			"bin/tool":   0755,
+			"lib/data":   0644,
+			"bin/helper": 0755 | os.ModeSetuid,
+		}
+		for _, file := range result.Files {
+			if file.Mode != expected[file.Name] {
+				t.Errorf("Expected mode %v for %s, got %v", expected[file.Name], file.Name, file.Mode)
+			}
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		zipWriter := zip.NewWriter(&buf)
+		header := &zip.FileHeader{Name: "bin/tool"}
+		header.SetMode(0755)
+		file, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		file.Write([]byte("x"))
+		zipWriter.Close()
+
+		result, err := extractZip(buf.Bytes(), ExtractLimits{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if result.Files[0].Mode != 0755 {
+			t.Errorf("Expected mode 0755, got %v", result.Files[0].Mode)
+		}
+	})
+}
+
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	data     string
+	mode     int64
+}
+
+func createTestTarWithEntries(entries []testTarEntry) []byte {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0755
+		}
+		tarWriter.WriteHeader(&tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Linkname: entry.linkname,
+			Mode:     mode,
+			Size:     int64(len(entry.data)),
+		})
+		tarWriter.Write([]byte(entry.data))
+	}
+	tarWriter.Close()
+	return buf.Bytes()
+}
+
+func TestExtractTarLinks(t *testing.T) {
+	tarData := createTestTarWithEntries([]testTarEntry{
+		{name: "lib/npm-cli.js", typeflag: tar.TypeReg, data: "cli"},
+		{name: "bin/npm", typeflag: tar.TypeSymlink, linkname: "../lib/npm-cli.js"},
+		{name: "bin/npm-copy", typeflag: tar.TypeLink, linkname: "lib/npm-cli.js"},
+	})
+
+	result, err := extractTar(tarData, ExtractLimits{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Files) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(result.Files))
+	}
+
+	symlink := result.Files[1]
+	if symlink.Name != "bin/npm" || symlink.Symlink != "../lib/npm-cli.js" {
+		t.Errorf("Expected symlink bin/npm -> ../lib/npm-cli.js, got %s -> %s", symlink.Name, symlink.Symlink)
+	}
+
+	hardlink := result.Files[2]
+	if hardlink.Hardlink != "lib/npm-cli.js" || string(hardlink.Data) != "cli" {
+		t.Errorf("Expected hard link to lib/npm-cli.js with its data, got %q with %q", hardlink.Hardlink, string(hardlink.Data))
+	}
+}
+
+func TestExtractTarRejectsUnsafeLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testTarEntry
+	}{
+		{
+			name: "absolute symlink target",
+			entries: []testTarEntry{
+				{name: "bin/sh", typeflag: tar.TypeSymlink, linkname: "/bin/sh"},
+			},
+		},
+		{
+			name: "symlink escaping root",
+			entries: []testTarEntry{
+				{name: "bin/evil", typeflag: tar.TypeSymlink, linkname: "../../etc/passwd"},
+			},
+		},
+		{
+			name: "dot-dot after path element",
+			entries: []testTarEntry{
+				{name: "lib", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "evil", typeflag: tar.TypeSymlink, linkname: "lib/../.."},
+			},
+		},
+		{
+			name: "symlink chained through symlink",
+			entries: []testTarEntry{
+				{name: "d/l", typeflag: tar.TypeSymlink, linkname: ".."},
+				{name: "d/l/l2", typeflag: tar.TypeSymlink, linkname: ".."},
+			},
+		},
+		{
+			name: "file written through symlink",
+			entries: []testTarEntry{
+				{name: "dir", typeflag: tar.TypeSymlink, linkname: "sub"},
+				{name: "dir/file", typeflag: tar.TypeReg, data: "x"},
+			},
+		},
+		{
+			name: "hard link escaping root",
+			entries: []testTarEntry{
+				{name: "evil", typeflag: tar.TypeLink, linkname: "../../etc/passwd"},
+			},
+		},
+		{
+			name: "hard link to missing entry",
+			entries: []testTarEntry{
+				{name: "link", typeflag: tar.TypeLink, linkname: "missing"},
+			},
+		},
+		{
+			name: "file replacing a hard link",
+			entries: []testTarEntry{
+				{name: "a", typeflag: tar.TypeReg, data: "good"},
+				{name: "b", typeflag: tar.TypeLink, linkname: "a"},
+				{name: "b", typeflag: tar.TypeReg, data: "evil"},
+			},
+		},
+		{
+			name: "file replacing a hard link target",
+			entries: []testTarEntry{
+				{name: "a", typeflag: tar.TypeReg, data: "good"},
+				{name: "b", typeflag: tar.TypeLink, linkname: "a"},
+				{name: "a", typeflag: tar.TypeReg, data: "evil"},
+			},
+		},
+		{
+			name: "hard link replacing a file",
+			entries: []testTarEntry{
+				{name: "a", typeflag: tar.TypeReg, data: "good"},
+				{name: "b", typeflag: tar.TypeReg, data: "other"},
+				{name: "b", typeflag: tar.TypeLink, linkname: "a"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := extractTar(createTestTarWithEntries(tt.entries), ExtractLimits{}); err == nil {
+				t.Errorf("Expected error, but got none")
+			}
+		})
+	}
+}
+
+func TestExtractZipSymlink(t *testing.T) {
+	createZip := func(target string) []byte {
+		var buf bytes.Buffer
+		zipWriter := zip.NewWriter(&buf)
+		header := &zip.FileHeader{Name: "bin/tool"}
+		header.SetMode(os.ModeSymlink | 0777)
+		file, _ := zipWriter.CreateHeader(header)
+		file.Write([]byte(target))
+		zipWriter.Close()
+		return buf.Bytes()
+	}
+
+	result, err := extractZip(createZip("../libexec/tool"), ExtractLimits{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Files[0].Symlink != "../libexec/tool" {
+		t.Errorf("Expected symlink target '../libexec/tool', got %q", result.Files[0].Symlink)
+	}
+
+	if _, err := extractZip(createZip("../../outside"), ExtractLimits{}); err == nil {
+		t.Errorf("Expected error for escaping zip symlink, but got none")
+	}
+}
+
 // Helper functions to create test archive data
 
 func createTestZip() ([]byte, error) {
@@ -335,4 +995,291 @@ func createTestGzip() ([]byte, error) {
 	}
 
 	return buf.Bytes(), nil
-}
\ No newline at end of file
+}
+
+func createTestTarXz() ([]byte, error) {
+	tarData, err := createTestTar()
+	if err != nil {
+		return nil, err
+	}
+
+	return compressXz(tarData)
+}
+
+func createTestXz() ([]byte, error) {
+	return compressXz([]byte("test file content"))
+}
+
+func compressXz(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	xzWriter, err := xz.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = xzWriter.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = xzWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func createTestTarZst() ([]byte, error) {
+	tarData, err := createTestTar()
+	if err != nil {
+		return nil, err
+	}
+
+	return compressZst(tarData)
+}
+
+func createTestZst() ([]byte, error) {
+	return compressZst([]byte("test file content"))
+}
+
+func compressZst(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zstWriter, err := zstd.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = zstWriter.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = zstWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// The standard library has no bzip2 writer, so these were produced with
+// bzip2 -9: testBz2Data holds "test file content" and testTarBz2Data holds
+// the output of createTestTar.
+var testBz2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xe6, 0x51,
+	0x99, 0xcd, 0x00, 0x00, 0x07, 0x91, 0x80, 0x40, 0x00, 0x0b, 0x25, 0x8c,
+	0x00, 0x20, 0x00, 0x31, 0x00, 0x30, 0x20, 0xd0, 0xd3, 0x20, 0x60, 0x88,
+	0x1a, 0x51, 0xea, 0x6d, 0x57, 0x8b, 0xb9, 0x22, 0x9c, 0x28, 0x48, 0x73,
+	0x28, 0xcc, 0xe6, 0x80,
+}
+
+var testTarBz2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xb3, 0x6e,
+	0xf4, 0xc8, 0x00, 0x00, 0x41, 0x5b, 0x90, 0xca, 0x80, 0x40, 0x01, 0x77,
+	0x04, 0x04, 0x00, 0x6b, 0x25, 0x9e, 0x40, 0x04, 0x00, 0x40, 0x08, 0x20,
+	0x00, 0x54, 0x34, 0x4d, 0x40, 0xd3, 0x26, 0x4d, 0x1a, 0x31, 0x30, 0x83,
+	0x15, 0x3d, 0x20, 0xd1, 0x90, 0xd0, 0x0d, 0x1a, 0x16, 0x4d, 0x37, 0xc4,
+	0x33, 0x80, 0x22, 0x33, 0xae, 0x28, 0x42, 0xf7, 0xda, 0x08, 0x40, 0xad,
+	0x9e, 0x9a, 0x08, 0x97, 0x20, 0x4c, 0xaa, 0x92, 0x23, 0x3c, 0x96, 0xf6,
+	0xb9, 0x20, 0x35, 0x01, 0xac, 0x90, 0x51, 0x28, 0xfd, 0x12, 0x0f, 0xa4,
+	0xe6, 0x95, 0x3b, 0x56, 0xc0, 0xef, 0x84, 0xbe, 0x1d, 0x02, 0x2f, 0xc5,
+	0xdc, 0x91, 0x4e, 0x14, 0x24, 0x2c, 0xdb, 0xbd, 0x32, 0x00,
+}
+
+func TestExtractArchiveStripComponents(t *testing.T) {
+	tarData := createTestTarWithEntries([]testTarEntry{
+		{name: "node-v18.17.0-linux-x64/lib/npm-cli.js", typeflag: tar.TypeReg, data: "cli"},
+		{name: "node-v18.17.0-linux-x64/bin/node", typeflag: tar.TypeReg, data: "node"},
+		{name: "node-v18.17.0-linux-x64/bin/npm", typeflag: tar.TypeSymlink, linkname: "../lib/npm-cli.js"},
+		{name: "node-v18.17.0-linux-x64/bin/npm-copy", typeflag: tar.TypeLink, linkname: "node-v18.17.0-linux-x64/lib/npm-cli.js"},
+	})
+
+	result, err := ExtractArchive(tarData, "node.tar", ExtractOptions{StripComponents: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	files := make(map[string]ExtractedFile)
+	for _, file := range result.Files {
+		files[file.Name] = file
+	}
+
+	if string(files["bin/node"].Data) != "node" {
+		t.Errorf("Expected bin/node with content 'node', got %+v", files["bin/node"])
+	}
+	if files["bin/npm"].Symlink != "../lib/npm-cli.js" {
+		t.Errorf("Expected bin/npm symlink to '../lib/npm-cli.js', got %q", files["bin/npm"].Symlink)
+	}
+	if files["bin/npm-copy"].Hardlink != "lib/npm-cli.js" {
+		t.Errorf("Expected bin/npm-copy hard link to 'lib/npm-cli.js', got %q", files["bin/npm-copy"].Hardlink)
+	}
+}
+
+func TestExtractArchiveStripComponentsRejectsUnexpectedLayouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testTarEntry
+		strip   int
+	}{
+		{
+			name: "file above the stripped depth",
+			entries: []testTarEntry{
+				{name: "tool-1.0/bin/tool", typeflag: tar.TypeReg, data: "tool"},
+				{name: "README", typeflag: tar.TypeReg, data: "readme"},
+			},
+			strip: 1,
+		},
+		{
+			name: "two top-level directories merge",
+			entries: []testTarEntry{
+				{name: "a/bin/tool", typeflag: tar.TypeReg, data: "a"},
+				{name: "b/bin/tool", typeflag: tar.TypeReg, data: "b"},
+			},
+			strip: 1,
+		},
+		{
+			name: "file replaces a directory",
+			entries: []testTarEntry{
+				{name: "a/bin", typeflag: tar.TypeReg, data: "a"},
+				{name: "b/bin/tool", typeflag: tar.TypeReg, data: "b"},
+			},
+			strip: 1,
+		},
+		{
+			name: "symlink escapes after stripping",
+			entries: []testTarEntry{
+				{name: "tool-1.0/lib", typeflag: tar.TypeSymlink, linkname: "../shared/lib"},
+				{name: "shared/lib/x", typeflag: tar.TypeReg, data: "x"},
+			},
+			strip: 1,
+		},
+		{
+			name: "stripping everything",
+			entries: []testTarEntry{
+				{name: "tool-1.0/tool", typeflag: tar.TypeReg, data: "tool"},
+			},
+			strip: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tarData := createTestTarWithEntries(tt.entries)
+			if _, err := ExtractArchive(tarData, "tool.tar", ExtractOptions{StripComponents: tt.strip}); err == nil {
+				t.Errorf("Expected error, but got none")
+			}
+		})
+	}
+}
+
+func TestExtractArchiveIncludeExclude(t *testing.T) {
+	tarData := createTestTarWithEntries([]testTarEntry{
+		{name: "sdk/bin/tool", typeflag: tar.TypeReg, data: "tool"},
+		{name: "sdk/bin/other", typeflag: tar.TypeReg, data: "other"},
+		{name: "sdk/lib/libtool.so", typeflag: tar.TypeReg, data: "lib"},
+		{name: "sdk/lib/libtool.a", typeflag: tar.TypeReg, data: "static"},
+		{name: "sdk/lib/libtool.so.1", typeflag: tar.TypeLink, linkname: "sdk/lib/libtool.so"},
+		{name: "sdk/bin/tool-alias", typeflag: tar.TypeLink, linkname: "sdk/bin/other"},
+		{name: "sdk/docs/index.html", typeflag: tar.TypeReg, data: "docs"},
+	})
+
+	result, err := ExtractArchive(tarData, "sdk.tar", ExtractOptions{
+		StripComponents: 1,
+		Include:         []string{"bin/tool*", "lib"},
+		Exclude:         []string{"**/*.a"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	files := make(map[string]ExtractedFile)
+	for _, file := range result.Files {
+		files[file.Name] = file
+	}
+
+	expected := []string{"bin/tool", "bin/tool-alias", "lib/libtool.so", "lib/libtool.so.1"}
+	if len(files) != len(expected) {
+		t.Errorf("Expected %d files, got %d: %v", len(expected), len(files), files)
+	}
+	for _, name := range expected {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Expected %s to be kept", name)
+		}
+	}
+
+	if result.Skipped != 3 {
+		t.Errorf("Expected 3 skipped entries, got %d", result.Skipped)
+	}
+
+	if files["lib/libtool.so.1"].Hardlink != "lib/libtool.so" {
+		t.Errorf("Expected hard link to kept target to be preserved, got %q", files["lib/libtool.so.1"].Hardlink)
+	}
+
+	// The alias points at a skipped entry, so it is written as a regular copy
+	alias := files["bin/tool-alias"]
+	if alias.Hardlink != "" || string(alias.Data) != "other" {
+		t.Errorf("Expected bin/tool-alias to become a regular file with content 'other', got %+v", alias)
+	}
+}
+
+func TestExtractPreservesModTimes(t *testing.T) {
+	modTime := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("tar", func(t *testing.T) {
+		var buf bytes.Buffer
+		tarWriter := tar.NewWriter(&buf)
+		tarWriter.WriteHeader(&tar.Header{Name: "bin/tool", Mode: 0755, Size: 1, Typeflag: tar.TypeReg, ModTime: modTime})
+		tarWriter.Write([]byte("x"))
+		tarWriter.WriteHeader(&tar.Header{Name: "bin/tool-link", Typeflag: tar.TypeLink, Linkname: "bin/tool"})
+		tarWriter.Close()
+
+		result, err := extractTar(buf.Bytes(), ExtractLimits{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, file := range result.Files {
+			if !file.ModTime.Equal(modTime) {
+				t.Errorf("Expected modification time %v for %s, got %v", modTime, file.Name, file.ModTime)
+			}
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		zipWriter := zip.NewWriter(&buf)
+		file, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "bin/tool", Modified: modTime})
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		file.Write([]byte("x"))
+		zipWriter.Close()
+
+		result, err := extractZip(buf.Bytes(), ExtractLimits{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if !result.Files[0].ModTime.Equal(modTime) {
+			t.Errorf("Expected modification time %v, got %v", modTime, result.Files[0].ModTime)
+		}
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		gzipWriter.ModTime = modTime
+		gzipWriter.Write([]byte("x"))
+		gzipWriter.Close()
+
+		result, err := extractGzip(buf.Bytes(), "tool.gz", ExtractLimits{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if !result.Files[0].ModTime.Equal(modTime) {
+			t.Errorf("Expected modification time %v, got %v", modTime, result.Files[0].ModTime)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// archiveTypes maps accepted archive-type values and file extensions to the
+// canonical format names used by ExtractArchive.
+var archiveTypes = map[string]string{
+	"zip":     "zip",
+	"tar":     "tar",
+	"tar.gz":  "tar.gz",
+	"tgz":     "tar.gz",
+	"gz":      "gz",
+	"tar.xz":  "tar.xz",
+	"txz":     "tar.xz",
+	"xz":      "xz",
+	"tar.zst": "tar.zst",
+	"tzst":    "tar.zst",
+	"zst":     "zst",
+	"tar.bz2": "tar.bz2",
+	"tbz2":    "tar.bz2",
+	"tbz":     "tar.bz2",
+	"bz2":     "bz2",
+	"deb":     "deb",
+	"rpm":     "rpm",
+}
+
+// archiveMagics lists the leading bytes that identify each container or
+// compression format.
+var archiveMagics = []struct {
+	format string
+	magic  []byte
+}{
+	{format: "zip", magic: []byte("PK\x03\x04")},
+	{format: "zip", magic: []byte("PK\x05\x06")},
+	{format: "gz", magic: []byte{0x1f, 0x8b}},
+	{format: "xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{format: "zst", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{format: "bz2", magic: []byte("BZh")},
+	{format: "deb", magic: []byte(arMagic)},
+	{format: "rpm", magic: rpmLeadMagic},
+}
+
+// ustarMagicOffset is where POSIX and GNU tar headers store "ustar".
+const ustarMagicOffset = 257
+
+func supportedArchiveTypes() []string {
+	names := make([]string, 0, len(archiveTypes))
+	for name := range archiveTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// normalizeArchiveType returns the canonical format for an archive-type value.
+func normalizeArchiveType(archiveType string) (string, error) {
+	format, ok := archiveTypes[strings.ToLower(archiveType)]
+	if !ok {
+		return "", fmt.Errorf("unsupported archive type %q, must be one of: %s", archiveType, strings.Join(supportedArchiveTypes(), ", "))
+	}
+	return format, nil
+}
+
+// formatFromFilename derives a format hint from the file extension, or ""
+// when the extension is not a known archive type.
+func formatFromFilename(filename string) string {
+	lower := strings.ToLower(filename)
+	for _, compression := range []string{"gz", "xz", "zst", "bz2"} {
+		if strings.HasSuffix(lower, ".tar."+compression) {
+			return "tar." + compression
+		}
+	}
+
+	dot := strings.LastIndex(lower, ".")
+	if dot < 0 {
+		return ""
+	}
+	return archiveTypes[lower[dot+1:]]
+}
+
+// formatFamily strips the tar layer from compressed tar formats, so "tar.gz"
+// and "gz" both belong to "gz".
+func formatFamily(format string) string {
+	if format == "tar" {
+		return format
+	}
+	return strings.TrimPrefix(format, "tar.")
+}
+
+func isTarFormat(format string) bool {
+	return format == "tar" || strings.HasPrefix(format, "tar.")
+}
+
+func hasUstarMagic(header []byte) bool {
+	return len(header) >= ustarMagicOffset+5 && string(header[ustarMagicOffset:ustarMagicOffset+5]) == "ustar"
+}
+
+// sniffFormat identifies the outer format from the leading bytes of data and
+// returns "" when nothing matches.
+func sniffFormat(data []byte) string {
+	for _, entry := range archiveMagics {
+		if bytes.HasPrefix(data, entry.magic) {
+			return entry.format
+		}
+	}
+	if hasUstarMagic(data) {
+		return "tar"
+	}
+	return ""
+}
+
+// sniffCompressedTar reports whether the decompressed stream starts with a
+// tar header. Only the first header block is decompressed.
+func sniffCompressedTar(compression string, data []byte) bool {
+	reader, err := openDecompressor(compression, bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(reader, header)
+	return hasUstarMagic(header[:n])
+}
+
+// detectArchiveFormat decides how to extract data. The leading bytes decide
+// the format; the archive-type override, or else the file extension, is only
+// a hint that must agree with them. For compressed content the hint decides
+// whether a tar archive is inside; without a hint the decompressed stream is
+// checked for a tar header.
+func detectArchiveFormat(data []byte, filename, archiveType string) (string, error) {
+	hint := formatFromFilename(filename)
+	hintSource := fmt.Sprintf("extension of %s", filename)
+	if archiveType != "" {
+		format, err := normalizeArchiveType(archiveType)
+		if err != nil {
+			return "", err
+		}
+		hint = format
+		hintSource = fmt.Sprintf("archive-type %q", archiveType)
+	}
+
+	sniffed := sniffFormat(data)
+
+	switch {
+	case sniffed == "" && hint == "":
+		return "", fmt.Errorf("unsupported archive format: cannot detect the format of %s from its contents or extension", filename)
+	case sniffed == "":
+		// Old v7 tar archives carry no magic, so a tar hint is trusted
+		if hint == "tar" {
+			return hint, nil
+		}
+		return "", fmt.Errorf("archive format mismatch: %s suggests %s, but the content is not a %s archive", hintSource, hint, formatFamily(hint))
+	case hint == "":
+		if sniffed != "zip" && sniffed != "tar" && sniffCompressedTar(sniffed, data) {
+			return "tar." + sniffed, nil
+		}
+		return sniffed, nil
+	case formatFamily(hint) != sniffed:
+		return "", fmt.Errorf("archive format mismatch: %s suggests %s, but the content is %s", hintSource, hint, sniffed)
+	default:
+		return hint, nil
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSniffFormat(t *testing.T) {
+	tarData, err := createTestTar()
+	if err != nil {
+		t.Fatalf("Failed to create test tar: %v", err)
+	}
+	zipData, err := createTestZip()
+	if err != nil {
+		t.Fatalf("Failed to create test zip: %v", err)
+	}
+	gzipData, err := createTestGzip()
+	if err != nil {
+		t.Fatalf("Failed to create test gzip: %v", err)
+	}
+	xzData, err := createTestXz()
+	if err != nil {
+		t.Fatalf("Failed to create test xz: %v", err)
+	}
+	zstData, err := createTestZst()
+	if err != nil {
+		t.Fatalf("Failed to create test zst: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{name: "zip", data: zipData, expected: "zip"},
+		{name: "tar", data: tarData, expected: "tar"},
+		{name: "gzip", data: gzipData, expected: "gz"},
+		{name: "xz", data: xzData, expected: "xz"},
+		{name: "zstd", data: zstData, expected: "zst"},
+		{name: "bzip2", data: testBz2Data, expected: "bz2"},
+		{name: "unknown", data: []byte("plain text"), expected: ""},
+		{name: "empty", data: nil, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if format := sniffFormat(tt.data); format != tt.expected {
+				t.Errorf("Expected format %q, got %q", tt.expected, format)
+			}
+		})
+	}
+}
+
+func TestDetectArchiveFormat(t *testing.T) {
+	tarGzData, err := createTestTarGz()
+	if err != nil {
+		t.Fatalf("Failed to create test tar.gz: %v", err)
+	}
+	gzipData, err := createTestGzip()
+	if err != nil {
+		t.Fatalf("Failed to create test gzip: %v", err)
+	}
+	zipData, err := createTestZip()
+	if err != nil {
+		t.Fatalf("Failed to create test zip: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		filename    string
+		archiveType string
+		expected    string
+		expectError string
+	}{
+		{
+			name:     "extension agrees with content",
+			data:     tarGzData,
+			filename: "tool.tar.gz",
+			expected: "tar.gz",
+		},
+		{
+			name:     "extensionless tar.gz",
+			data:     tarGzData,
+			filename: "download",
+			expected: "tar.gz",
+		},
+		{
+			name:     "extensionless gzip of a single file",
+			data:     gzipData,
+			filename: "download",
+			expected: "gz",
+		},
+		{
+			name:     "extensionless bzip2 tar",
+			data:     testTarBz2Data,
+			filename: "download",
+			expected: "tar.bz2",
+		},
+		{
+			name:     "uppercase extension",
+			data:     zipData,
+			filename: "TOOL.ZIP",
+			expected: "zip",
+		},
+		{
+			name:        "zip mislabelled as tar.gz",
+			data:        zipData,
+			filename:    "tool.tar.gz",
+			expectError: "archive format mismatch",
+		},
+		{
+			name:        "html error page saved as zip",
+			data:        []byte("<html>Not Found</html>"),
+			filename:    "tool.zip",
+			expectError: "archive format mismatch",
+		},
+		{
+			name:        "unknown content without extension",
+			data:        []byte("plain text"),
+			filename:    "download",
+			expectError: "unsupported archive format",
+		},
+		{
+			name:        "archive-type overrides extension",
+			data:        tarGzData,
+			filename:    "download.bin",
+			archiveType: "tgz",
+			expected:    "tar.gz",
+		},
+		{
+			name:        "archive-type must agree with content",
+			data:        zipData,
+			filename:    "download",
+			archiveType: "tar.xz",
+			expectError: "archive format mismatch",
+		},
+		{
+			name:        "unsupported archive-type",
+			data:        zipData,
+			filename:    "download",
+			archiveType: "rar",
+			expectError: "unsupported archive type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := detectArchiveFormat(tt.data, tt.filename, tt.archiveType)
+			if tt.expectError != "" {
+				if err == nil {
+					t.Fatalf("Expected error, but got format %q", format)
+				}
+				if !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if format != tt.expected {
+				t.Errorf("Expected format %q, got %q", tt.expected, format)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveWithoutExtension(t *testing.T) {
+	tarGzData, err := createTestTarGz()
+	if err != nil {
+		t.Fatalf("Failed to create test tar.gz: %v", err)
+	}
+
+	result, err := ExtractArchive(tarGzData, "download", ExtractOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Files) == 0 {
+		t.Errorf("Expected extracted files, got none")
+	}
+}
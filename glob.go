@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// validateGlob checks that a pattern can be used with matchGlob.
+func validateGlob(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty pattern")
+	}
+	if strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("pattern %q must be relative", pattern)
+	}
+
+	for _, element := range strings.Split(pattern, "/") {
+		if element == "**" {
+			continue
+		}
+		if strings.Contains(element, "**") {
+			return fmt.Errorf("pattern %q uses '**' inside a path element", pattern)
+		}
+		if _, err := path.Match(element, ""); err != nil {
+			return fmt.Errorf("pattern %q is malformed: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// matchGlob reports whether a slash-separated path matches pattern. Each
+// pattern element is matched with path.Match, and a "**" element matches
+// any number of path elements, including none. A pattern that matches a
+// leading directory of name matches everything below it as well.
+func matchGlob(pattern, name string) bool {
+	patternElements := strings.Split(path.Clean(pattern), "/")
+	nameElements := strings.Split(name, "/")
+
+	for end := len(nameElements); end > 0; end-- {
+		if matchElements(patternElements, nameElements[:end]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(name); skip++ {
+				if matchElements(pattern[1:], name[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{pattern: "bin/tool", name: "bin/tool", expected: true},
+		{pattern: "bin/*", name: "bin/tool", expected: true},
+		{pattern: "bin/*", name: "bin/sub/tool", expected: true},
+		{pattern: "lib", name: "lib/libfoo.so", expected: true},
+		{pattern: "lib", name: "libexec/foo", expected: false},
+		{pattern: "*.so", name: "lib/libfoo.so", expected: false},
+		{pattern: "**/*.so", name: "lib/libfoo.so", expected: true},
+		{pattern: "**/*.so", name: "libfoo.so", expected: true},
+		{pattern: "**/*.so", name: "lib/x86_64/libfoo.so", expected: true},
+		{pattern: "share/**/man1/*", name: "share/man/man1/tool.1", expected: true},
+		{pattern: "share/**/man1/*", name: "share/man1/tool.1", expected: true},
+		{pattern: "share/**/man1/*", name: "share/man/man8/tool.8", expected: false},
+		{pattern: "**", name: "anything/at/all", expected: true},
+		{pattern: "doc/**", name: "docs/readme", expected: false},
+		{pattern: "bin/tool?", name: "bin/tool2", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if matched := matchGlob(tt.pattern, tt.name); matched != tt.expected {
+				t.Errorf("matchGlob(%q, %q) = %v, expected %v", tt.pattern, tt.name, matched, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		expectError bool
+	}{
+		{name: "plain path", pattern: "bin/tool", expectError: false},
+		{name: "double star", pattern: "**/*.so", expectError: false},
+		{name: "character class", pattern: "bin/[a-z]*", expectError: false},
+		{name: "empty", pattern: "", expectError: true},
+		{name: "absolute", pattern: "/bin/tool", expectError: true},
+		{name: "double star inside element", pattern: "lib/**.so", expectError: true},
+		{name: "unclosed class", pattern: "bin/[a-z", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGlob(tt.pattern)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ module github.com/alvarolm/vfetch
 go 1.25.0
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/tidwall/jsonc v0.3.2
+	github.com/ulikunitz/xz v0.5.15
 	golang.org/x/crypto v0.42.0
 )
 
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// ExtractLimits bounds the resources a single archive may use while it is
+// extracted. Zero fields fall back to the defaults below.
+type ExtractLimits struct {
+	MaxTotalSize int64   `json:"max-total-size"`
+	MaxFileSize  int64   `json:"max-file-size"`
+	MaxEntries   int     `json:"max-entries"`
+	MaxRatio     float64 `json:"max-ratio"`
+}
+
+var defaultExtractLimits = ExtractLimits{
+	MaxTotalSize: 2 << 30,
+	MaxFileSize:  1 << 30,
+	MaxEntries:   100000,
+	MaxRatio:     200,
+}
+
+// ratioCheckFloor is the uncompressed size below which the compression ratio
+// is not enforced, so small but highly compressible archives still extract.
+const ratioCheckFloor = 16 << 20
+
+// withDefaults fills zero fields from fallback.
+func (limits ExtractLimits) withDefaults(fallback ExtractLimits) ExtractLimits {
+	if limits.MaxTotalSize == 0 {
+		limits.MaxTotalSize = fallback.MaxTotalSize
+	}
+	if limits.MaxFileSize == 0 {
+		limits.MaxFileSize = fallback.MaxFileSize
+	}
+	if limits.MaxEntries == 0 {
+		limits.MaxEntries = fallback.MaxEntries
+	}
+	if limits.MaxRatio == 0 {
+		limits.MaxRatio = fallback.MaxRatio
+	}
+	return limits
+}
+
+func (limits ExtractLimits) validate() error {
+	switch {
+	case limits.MaxTotalSize < 0:
+		return fmt.Errorf("max-total-size must not be negative")
+	case limits.MaxFileSize < 0:
+		return fmt.Errorf("max-file-size must not be negative")
+	case limits.MaxEntries < 0:
+		return fmt.Errorf("max-entries must not be negative")
+	case limits.MaxRatio < 0:
+		return fmt.Errorf("max-ratio must not be negative")
+	}
+	return nil
+}
+
+// extractBudget tracks how much of its limits an archive has used. Every
+// entry is read through it, so a lying header or a decompression bomb stops
+// at the limit instead of after it has been read into memory.
+type extractBudget struct {
+	limits       ExtractLimits
+	maxTotalSize int64
+	ratioBound   bool
+	totalSize    int64
+	entries      int
+}
+
+func newExtractBudget(limits ExtractLimits, compressedSize int) *extractBudget {
+	limits = limits.withDefaults(defaultExtractLimits)
+
+	budget := &extractBudget{limits: limits, maxTotalSize: limits.MaxTotalSize}
+
+	// The ratio turns into a tighter total size for small downloads
+	ratioLimit := int64(limits.MaxRatio * float64(compressedSize))
+	if ratioLimit < ratioCheckFloor {
+		ratioLimit = ratioCheckFloor
+	}
+	if ratioLimit < budget.maxTotalSize {
+		budget.maxTotalSize = ratioLimit
+		budget.ratioBound = true
+	}
+
+	return budget
+}
+
+// addEntry counts one archive entry against max-entries.
+func (budget *extractBudget) addEntry() error {
+	budget.entries++
+	if budget.entries > budget.limits.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries (max-entries)", budget.limits.MaxEntries)
+	}
+	return nil
+}
+
+// readEntry reads the contents of one entry, failing as soon as it exceeds
+// max-file-size or the archive exceeds its total size budget.
+func (budget *extractBudget) readEntry(name string, r io.Reader) ([]byte, error) {
+	remaining := budget.maxTotalSize - budget.totalSize
+	readLimit := min(budget.limits.MaxFileSize, remaining)
+
+	data, err := io.ReadAll(io.LimitReader(r, readLimit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := budget.charge(name, int64(len(data))); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// charge counts size bytes written for name against the limits.
+func (budget *extractBudget) charge(name string, size int64) error {
+	if size > budget.limits.MaxFileSize {
+		return fmt.Errorf("%s is larger than %d bytes (max-file-size)", name, budget.limits.MaxFileSize)
+	}
+	if budget.totalSize+size > budget.maxTotalSize {
+		if budget.ratioBound {
+			return fmt.Errorf("archive expands to more than %d bytes, over %g times its compressed size (max-ratio)", budget.maxTotalSize, budget.limits.MaxRatio)
+		}
+		return fmt.Errorf("archive expands to more than %d bytes (max-total-size)", budget.maxTotalSize)
+	}
+
+	budget.totalSize += size
+	return nil
+}
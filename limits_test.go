@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// createZeroTarGz builds a tar.gz of files filled with zero bytes, which
+// compresses to a tiny fraction of its extracted size.
+func createZeroTarGz(t *testing.T, files int, size int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	zeros := make([]byte, size)
+	for i := 0; i < files; i++ {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: fmt.Sprintf("file%d", i), Mode: 0644, Size: int64(size), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tarWriter.Write(zeros); err != nil {
+			t.Fatalf("Failed to write tar entry: %v", err)
+		}
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+
+	return buf.Bytes()
+}
+
+func TestExtractLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        func(t *testing.T) []byte
+		filename    string
+		limits      ExtractLimits
+		expectError string
+	}{
+		{
+			name:     "within defaults",
+			data:     func(t *testing.T) []byte { return createZeroTarGz(t, 3, 1024) },
+			filename: "ok.tar.gz",
+		},
+		{
+			name:        "compression ratio",
+			data:        func(t *testing.T) []byte { return createZeroTarGz(t, 1, 32<<20) },
+			filename:    "bomb.tar.gz",
+			expectError: "max-ratio",
+		},
+		{
+			name:        "compression ratio of a single gzip file",
+			data:        func(t *testing.T) []byte { return createZeroGzip(t, 32<<20) },
+			filename:    "bomb.gz",
+			expectError: "max-ratio",
+		},
+		{
+			name:        "file size",
+			data:        func(t *testing.T) []byte { return createZeroTarGz(t, 1, 4096) },
+			filename:    "big.tar.gz",
+			limits:      ExtractLimits{MaxFileSize: 1024},
+			expectError: "max-file-size",
+		},
+		{
+			name:        "total size",
+			data:        func(t *testing.T) []byte { return createZeroTarGz(t, 4, 1024) },
+			filename:    "many.tar.gz",
+			limits:      ExtractLimits{MaxTotalSize: 3000},
+			expectError: "max-total-size",
+		},
+		{
+			name:        "entry count",
+			data:        func(t *testing.T) []byte { return createZeroTarGz(t, 5, 1) },
+			filename:    "many.tar.gz",
+			limits:      ExtractLimits{MaxEntries: 4},
+			expectError: "max-entries",
+		},
+		{
+			name:        "zip file size",
+			data:        func(t *testing.T) []byte { return createZeroZip(t, 4096) },
+			filename:    "big.zip",
+			limits:      ExtractLimits{MaxFileSize: 1024},
+			expectError: "max-file-size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExtractArchive(tt.data(t), tt.filename, ExtractOptions{Limits: tt.limits})
+			if tt.expectError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Expected error, but got none")
+			}
+			if !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error mentioning %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestExtractLimitsHardlinkCopies(t *testing.T) {
+	entries := []testTarEntry{{name: "big", typeflag: tar.TypeReg, data: strings.Repeat("x", 2000)}}
+	for i := 0; i < 4; i++ {
+		entries = append(entries, testTarEntry{name: fmt.Sprintf("link%d", i), typeflag: tar.TypeLink, linkname: "big"})
+	}
+	tarData := createTestTarWithEntries(entries)
+	limits := ExtractLimits{MaxTotalSize: 5000}
+
+	// Hard links to a kept file are not written as copies
+	if _, err := ExtractArchive(tarData, "links.tar", ExtractOptions{Limits: limits, Include: []string{"**"}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Excluding the target turns every link into a full copy
+	_, err := ExtractArchive(tarData, "links.tar", ExtractOptions{Limits: limits, Exclude: []string{"big"}})
+	if err == nil {
+		t.Fatalf("Expected error, but got none")
+	}
+	if !strings.Contains(err.Error(), "max-total-size") {
+		t.Errorf("Expected error mentioning max-total-size, got %v", err)
+	}
+}
+
+func createZeroGzip(t *testing.T, size int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	if _, err := gzipWriter.Write(make([]byte, size)); err != nil {
+		t.Fatalf("Failed to write gzip data: %v", err)
+	}
+	gzipWriter.Close()
+
+	return buf.Bytes()
+}
+
+func createZeroZip(t *testing.T, size int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	file, err := zipWriter.Create("zeros")
+	if err != nil {
+		t.Fatalf("Failed to create zip entry: %v", err)
+	}
+	if _, err := file.Write(make([]byte, size)); err != nil {
+		t.Fatalf("Failed to write zip entry: %v", err)
+	}
+	zipWriter.Close()
+
+	return buf.Bytes()
+}
+
+func TestExtractLimitsWithDefaults(t *testing.T) {
+	global := ExtractLimits{MaxTotalSize: 100, MaxEntries: 10}
+	item := ExtractLimits{MaxTotalSize: 50}
+
+	limits := item.withDefaults(global).withDefaults(defaultExtractLimits)
+
+	if limits.MaxTotalSize != 50 {
+		t.Errorf("Expected item max-total-size 50, got %d", limits.MaxTotalSize)
+	}
+	if limits.MaxEntries != 10 {
+		t.Errorf("Expected global max-entries 10, got %d", limits.MaxEntries)
+	}
+	if limits.MaxFileSize != defaultExtractLimits.MaxFileSize {
+		t.Errorf("Expected default max-file-size, got %d", limits.MaxFileSize)
+	}
+}
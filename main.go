@@ -8,11 +8,47 @@ import (
 
 func main() {
 	var configPath string
+	var force bool
 	flag.StringVar(&configPath, "config", "", "Path to configuration file")
+	flag.BoolVar(&force, "force", false, "Reinstall items even when they are already up to date")
 	flag.Parse()
 
-	fetchNames := flag.Args()
+	args := flag.Args()
 
+	if len(args) > 0 {
+		switch args[0] {
+		case "treehash":
+			runTreeHash(args[1:])
+			return
+		case "verify":
+			runVerify(configPath, args[1:])
+			return
+		case "use":
+			runUse(configPath, args[1:])
+			return
+		case "rollback":
+			runRollback(configPath, args[1:])
+			return
+		}
+	}
+
+	config, fetchItems := loadFetchItems(configPath, args)
+	config.Force = force
+
+	for i, fetchItem := range fetchItems {
+		fmt.Printf("Processing item %d: %s\n", i+1, fetchItem.Name)
+
+		if err := ProcessFetchItem(config, fetchItem); err != nil {
+			log.Fatalf("Failed to process fetch item %s: %v", fetchItem.Name, err)
+		}
+
+		fmt.Printf("Successfully processed: %s\n", fetchItem.Name)
+	}
+
+	fmt.Println("All items processed successfully")
+}
+
+func loadFetchItems(configPath string, fetchNames []string) (*Config, []FetchItem) {
 	if configPath == "" {
 		fmt.Printf("Using default config path since none was provided\n")
 		fmt.Printf("To specify a custom path, use: vfetch -config <path>\n")
@@ -34,15 +70,86 @@ func main() {
 		log.Fatalf("Failed to filter fetch items: %v", err)
 	}
 
-	for i, fetchItem := range fetchItems {
-		fmt.Printf("Processing item %d: %s\n", i+1, fetchItem.Name)
+	return config, fetchItems
+}
 
-		if err := ProcessFetchItem(config, fetchItem); err != nil {
-			log.Fatalf("Failed to process fetch item %s: %v", fetchItem.Name, err)
+// runTreeHash prints the tree hash of each directory, for pinning as tree-hash.
+func runTreeHash(dirs []string) {
+	if len(dirs) == 0 {
+		log.Fatalf("Usage: vfetch treehash <dir>...")
+	}
+
+	for _, dir := range dirs {
+		treeHash, err := TreeHash(dir)
+		if err != nil {
+			log.Fatalf("Failed to compute tree hash: %v", err)
+		}
+		fmt.Printf("%s  %s\n", treeHash, dir)
+	}
+}
+
+// runVerify re-checks installed items against their pinned hashes without
+// downloading anything.
+func runVerify(configPath string, fetchNames []string) {
+	config, fetchItems := loadFetchItems(configPath, fetchNames)
+
+	for _, fetchItem := range fetchItems {
+		checked, err := VerifyInstalledItem(config, fetchItem)
+		if err != nil {
+			log.Fatalf("Verification failed for %s: %v", fetchItem.Name, err)
 		}
 
-		fmt.Printf("Successfully processed: %s\n", fetchItem.Name)
+		switch {
+		case checked:
+			fmt.Printf("Verified: %s\n", fetchItem.Name)
+		case fetchItem.Decompress:
+			fmt.Printf("Skipped (pinned hashes cover the compressed download): %s\n", fetchItem.Name)
+		default:
+			fmt.Printf("Skipped (no tree-hash pinned): %s\n", fetchItem.Name)
+		}
 	}
 
-	fmt.Println("All items processed successfully")
+	fmt.Println("All items verified successfully")
+}
+
+// runUse switches a versioned item to one of its installed versions.
+func runUse(configPath string, args []string) {
+	if len(args) != 2 {
+		log.Fatalf("Usage: vfetch use <name> <version>")
+	}
+
+	config, fetchItems := loadFetchItems(configPath, args[:1])
+
+	if err := UseVersion(config, fetchItems[0], args[1]); err != nil {
+		log.Fatalf("Failed to switch %s to %s: %v", args[0], args[1], err)
+	}
+
+	fmt.Printf("Now using %s %s\n", args[0], args[1])
+	warnConfiguredVersion(fetchItems[0], args[1])
+}
+
+// runRollback switches a versioned item back to the version installed before
+// the current one.
+func runRollback(configPath string, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("Usage: vfetch rollback <name>")
+	}
+
+	config, fetchItems := loadFetchItems(configPath, args)
+
+	version, err := RollbackVersion(config, fetchItems[0])
+	if err != nil {
+		log.Fatalf("Failed to roll back %s: %v", args[0], err)
+	}
+
+	fmt.Printf("Rolled back %s to %s\n", args[0], version)
+	warnConfiguredVersion(fetchItems[0], version)
+}
+
+// warnConfiguredVersion reminds the user that the next plain run reinstalls
+// the configured version when it differs from the one switched to.
+func warnConfiguredVersion(item FetchItem, version string) {
+	if item.Version != version {
+		fmt.Printf("Note: the config still sets version %s; set \"version\" to %s to stay on it, the next run switches back otherwise\n", item.Version, version)
+	}
 }
@@ -3,24 +3,27 @@ package main
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
-func removeExisting(path string) error {
-	if _, err := os.Lstat(path); err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("failed to check if path exists: %w", err)
-	}
+// isLocalPath reports whether name stays inside the directory it is joined
+// onto. A leading separator is allowed and means relative to that directory.
+func isLocalPath(name string) bool {
+	rel := strings.TrimLeft(filepath.FromSlash(name), string(filepath.Separator))
+	return filepath.IsLocal(rel)
+}
 
-	if err := os.RemoveAll(path); err != nil {
-		return fmt.Errorf("failed to remove existing path: %w", err)
+// resolveInRoot joins name onto root and fails if the result would escape it.
+func resolveInRoot(root, name string) (string, error) {
+	if !isLocalPath(name) {
+		return "", fmt.Errorf("path %q escapes %s", name, root)
 	}
-
-	fmt.Printf("Removed existing: %s\n", path)
-	return nil
+	return filepath.Join(root, name), nil
 }
 
 var versionMatcher = regexp.MustCompile(`(?i)\$version`)
@@ -29,7 +32,32 @@ func replaceVersionPlaceholders(url, version string) string {
 	return versionMatcher.ReplaceAllString(url, version)
 }
 
+func verifyItemHash(data []byte, item FetchItem) error {
+	if item.Hash != "" {
+		if err := VerifyHash(data, item.Hash); err != nil {
+			return fmt.Errorf("hash verification failed: %w", err)
+		}
+	} else if len(item.Hashes) > 0 {
+		if err := VerifyHashes(data, item.Hashes); err != nil {
+			return fmt.Errorf("hash verification failed: %w", err)
+		}
+	} else {
+		return fmt.Errorf("no hash or hashes specified for verification")
+	}
+
+	return nil
+}
+
+// normalizedModTime is the modification time written for every file when
+// normalize-mtime is set.
+var normalizedModTime = time.Unix(0, 0)
+
 func ProcessFetchItem(config *Config, item FetchItem) error {
+	if !config.Force && isUpToDate(config, item) {
+		fmt.Printf("Already up to date, skipping (use -force to reinstall)\n")
+		return nil
+	}
+
 	finalURL := replaceVersionPlaceholders(item.URL, item.Version)
 	fmt.Printf("Downloading: %s\n", finalURL)
 	downloadResult, err := DownloadFile(finalURL)
@@ -38,69 +66,432 @@ func ProcessFetchItem(config *Config, item FetchItem) error {
 	}
 
 	fmt.Printf("Verifying hash...\n")
-	if item.Hash != "" {
-		if err := VerifyHash(downloadResult.Data, item.Hash); err != nil {
-			return fmt.Errorf("hash verification failed: %w", err)
-		}
-	} else if len(item.Hashes) > 0 {
-		if err := VerifyHashes(downloadResult.Data, item.Hashes); err != nil {
-			return fmt.Errorf("hash verification failed: %w", err)
-		}
-	} else {
-		return fmt.Errorf("no hash or hashes specified for verification")
+	if err := verifyItemHash(downloadResult.Data, item); err != nil {
+		return err
 	}
 
 	var filesToWrite []FileToWrite
+	var dirLinks []BinLink
+	outputDir := item.GetOutputDir(config.OutputDir)
+	installRoot, installName := itemLayout(outputDir, item)
 
 	if item.Extract {
 		fmt.Printf("Extracting archive...\n")
-		extractResult, err := ExtractArchive(downloadResult.Data, downloadResult.Filename)
+		extractResult, err := extractItem(downloadResult.Data, downloadResult.Filename, item, config.ExtractLimits)
 		if err != nil {
 			return fmt.Errorf("extraction failed: %w", err)
 		}
+		if extractResult.Skipped > 0 {
+			fmt.Printf("Skipped %d of %d entries not matching include/exclude filters\n", extractResult.Skipped, extractResult.Skipped+len(extractResult.Files))
+		}
+
+		if len(item.FileHashes) > 0 {
+			fmt.Printf("Verifying extracted file hashes...\n")
+			if err := verifyFileHashes(extractResult.Files, item.FileHashes); err != nil {
+				return fmt.Errorf("file hash verification failed: %w", err)
+			}
+		}
+
+		if len(item.BinDirs) > 0 {
+			dirLinks, err = binDirLinks(extractResult.Files, item.BinDirs)
+			if err != nil {
+				return fmt.Errorf("invalid bin-dirs: %w", err)
+			}
+		}
 
 		for _, extractedFile := range extractResult.Files {
-			// Create files under a directory named after the fetch item
-			filePath := filepath.Join(item.Name, extractedFile.Name)
-			filesToWrite = append(filesToWrite, FileToWrite{
-				Name: filePath,
-				Data: extractedFile.Data,
-			})
+			// Create files under a directory named after the fetch item, or
+			// after the version in the versioned layout
+			filePath := filepath.Join(installName, extractedFile.Name)
+			mode := extractedFile.Mode
+			if item.StripSetuid {
+				mode &^= os.ModeSetuid | os.ModeSetgid
+			}
+			fileToWrite := FileToWrite{
+				Name:    filePath,
+				Data:    extractedFile.Data,
+				Mode:    mode,
+				Symlink: extractedFile.Symlink,
+				ModTime: extractedFile.ModTime,
+			}
+			if extractedFile.Hardlink != "" {
+				fileToWrite.Hardlink = filepath.Join(installName, extractedFile.Hardlink)
+			}
+			filesToWrite = append(filesToWrite, fileToWrite)
+		}
+	} else if item.Decompress {
+		fmt.Printf("Decompressing file...\n")
+		decompressed, err := DecompressFile(downloadResult.Data, downloadResult.Filename, item.ArchiveType, item.GetExtractLimits(config.ExtractLimits))
+		if err != nil {
+			return fmt.Errorf("decompression failed: %w", err)
 		}
+
+		// Written like a plain download, named after the item
+		filesToWrite = append(filesToWrite, FileToWrite{
+			Name:    singleFilePath(installName, item),
+			Data:    decompressed.Data,
+			ModTime: decompressed.ModTime,
+		})
 	} else {
 		filesToWrite = append(filesToWrite, FileToWrite{
-			Name: item.Name,
+			Name: singleFilePath(installName, item),
 			Data: downloadResult.Data,
 		})
 	}
 
-	outputDir := item.GetOutputDir(config.OutputDir)
-	if outputDir != "" {
-		if err := writeFiles(filesToWrite, outputDir, item.Extract, item.Name); err != nil {
-			return fmt.Errorf("failed to write files: %w", err)
+	if item.NormalizeMtime {
+		for i := range filesToWrite {
+			filesToWrite[i].ModTime = normalizedModTime
 		}
 	}
 
-	binFile, shouldCreateSymlink := item.GetBinFileString()
-	if shouldCreateSymlink {
-		binDir := item.GetBinDir(config.BinsDir)
+	binLinks, err := item.GetBinLinks()
+	if err != nil {
+		return fmt.Errorf("invalid bin-files: %w", err)
+	}
+	allLinks, err := mergeBinLinks(binLinks, dirLinks)
+	if err != nil {
+		return err
+	}
+	binDir := item.GetBinDir(config.BinsDir)
+	if len(allLinks) > 0 {
 		if binDir == "" {
 			return fmt.Errorf("bins-dir not specified for binary symlink")
 		}
+		if !item.Extract && outputDir == "" {
+			return fmt.Errorf("output-dir required when creating symlink for non-extracted file")
+		}
+	}
+	if item.TreeHash != "" && outputDir == "" {
+		return fmt.Errorf("output-dir required to verify tree-hash")
+	}
+
+	if item.Versioned && outputDir == "" {
+		return fmt.Errorf("output-dir required for the versioned layout")
+	}
 
-		var targetPath string
-		if item.Extract {
-			targetPath = filepath.Join(outputDir, item.Name, binFile)
-		} else {
-			if outputDir == "" {
-				return fmt.Errorf("output-dir required when creating symlink for non-extracted file")
+	// The bin entries run the installed files, but hard links and copies are
+	// made from the staged ones, which are renamed into place unchanged
+	itemPath := installedItemPath(outputDir, item)
+	sourcePath := itemPath
+
+	var stagingDir string
+	if outputDir != "" {
+		if item.Versioned {
+			if err := checkVersionedRoot(installRoot); err != nil {
+				return err
 			}
-			targetPath = filepath.Join(outputDir, item.Name)
 		}
 
-		symlinkName := filepath.Base(binFile)
-		if err := createSymlink(targetPath, binDir, symlinkName); err != nil {
-			return fmt.Errorf("failed to create symlink: %w", err)
+		stagingDir, err = stageFiles(filesToWrite, installRoot, installName)
+		if stagingDir != "" {
+			defer os.RemoveAll(stagingDir)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write files: %w", err)
+		}
+
+		stagedItem := filepath.Join(stagingDir, installName)
+		for _, link := range binLinks {
+			stagedTarget, err := binTargetPath(stagedItem, item, link.Path)
+			if err != nil {
+				return fmt.Errorf("invalid bin-file: %w", err)
+			}
+			if err := os.Chmod(stagedTarget, 0755); err != nil {
+				fmt.Printf("Warning: failed to make target executable: %v\n", err)
+			}
+		}
+
+		// The tree hash covers the item directory as it will be installed,
+		// including the executable bits set on the bin files above
+		if item.TreeHash != "" {
+			fmt.Printf("Verifying tree hash...\n")
+			if err := VerifyTreeHash(stagedItem, item.TreeHash); err != nil {
+				return fmt.Errorf("tree hash verification failed: %w", err)
+			}
+		}
+
+		sourcePath = stagedItem
+	}
+
+	binMode := item.GetBinMode(config.BinMode)
+	binEnv, err := itemBinEnv(item, itemPath)
+	if err != nil {
+		return err
+	}
+
+	var entries []binEntry
+	var installedLinks []BinLinkState
+	for _, link := range allLinks {
+		targetPath, err := binTargetPath(itemPath, item, link.Path)
+		if err != nil {
+			return fmt.Errorf("invalid bin-file: %w", err)
+		}
+		sourceFile, err := binTargetPath(sourcePath, item, link.Path)
+		if err != nil {
+			return fmt.Errorf("invalid bin-file: %w", err)
+		}
+		absTargetPath, err := filepath.Abs(targetPath)
+		if err != nil {
+			return fmt.Errorf("failed to resolve absolute path for target: %w", err)
+		}
+		entries = append(entries, binEntry{Name: link.Name, Target: targetPath, Source: sourceFile})
+		installedLinks = append(installedLinks, BinLinkState{Path: filepath.Join(binDir, link.Name), Target: absTargetPath})
+	}
+
+	// Bin entries are prepared before anything is replaced, so an unwritable
+	// bins-dir leaves the previous install untouched
+	var preparedLinks *preparedBinEntries
+	if len(entries) > 0 {
+		if err := checkBinOwnership(binDir, entries, installedBinLinks(outputDir, item.Name), filepath.Join(outputDir, item.Name)); err != nil {
+			return err
+		}
+		preparedLinks, err = prepareBinEntries(binDir, item.Name, entries, binMode, binEnv)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", binMode, err)
+		}
+		defer preparedLinks.cleanup()
+	}
+
+	// Until everything is in place, a failure puts the previous version back
+	installed := false
+
+	if stagingDir != "" {
+		restoreItem, err := commitStaged(stagingDir, installRoot)
+		if err != nil {
+			return fmt.Errorf("failed to install files: %w", err)
+		}
+		defer func() {
+			if !installed {
+				if err := restoreItem(); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+			}
+		}()
+
+		if item.Versioned {
+			restoreCurrent, err := setCurrentVersion(installRoot, installName)
+			if err != nil {
+				return fmt.Errorf("failed to switch version: %w", err)
+			}
+			defer func() {
+				if !installed {
+					if err := restoreCurrent(); err != nil {
+						fmt.Printf("Warning: %v\n", err)
+					}
+				}
+			}()
+		}
+	}
+
+	if preparedLinks != nil {
+		if err := preparedLinks.commit(); err != nil {
+			return fmt.Errorf("failed to create %s: %w", binMode, err)
+		}
+	}
+
+	installed = true
+
+	if item.Versioned {
+		if err := recordVersion(installRoot, installName); err != nil {
+			return err
+		}
+		if err := pruneVersions(installRoot, item.GetKeepVersions(config.KeepVersions)); err != nil {
+			return fmt.Errorf("failed to remove old versions: %w", err)
+		}
+	}
+
+	if outputDir != "" {
+		if err := recordInstall(config, item, downloadResult.Data, installedLinks); err != nil {
+			return fmt.Errorf("failed to record install state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// binTargetPath returns the file a bin symlink points to, given the path of
+// the item inside the output directory.
+func binTargetPath(itemPath string, item FetchItem, binFile string) (string, error) {
+	if item.Extract {
+		return resolveInRoot(itemPath, binFile)
+	}
+	return singleFilePath(itemPath, item), nil
+}
+
+// binDirLinks returns a link for every regular executable file directly inside
+// the bin-dirs directories, named after the file. Symlinks are skipped.
+func binDirLinks(files []ExtractedFile, binDirs []BinDirectory) ([]BinLink, error) {
+	var links []BinLink
+	for _, binDir := range binDirs {
+		dirPath := cleanArchivePath(binDir.Path)
+		found := false
+		var dirLinks []BinLink
+
+		for _, file := range files {
+			relPath := file.Name
+			if dirPath != "" {
+				if !strings.HasPrefix(file.Name, dirPath+"/") {
+					continue
+				}
+				relPath = strings.TrimPrefix(file.Name, dirPath+"/")
+			}
+			found = true
+
+			if strings.Contains(relPath, "/") || file.Symlink != "" || file.Mode&0111 == 0 {
+				continue
+			}
+			if len(binDir.Include) > 0 && !matchAnyGlob(binDir.Include, relPath) {
+				continue
+			}
+			if matchAnyGlob(binDir.Exclude, relPath) {
+				continue
+			}
+			dirLinks = append(dirLinks, BinLink{Name: relPath, Path: file.Name})
+		}
+
+		if !found {
+			return nil, fmt.Errorf("directory %s not found in the extracted files", binDir.Path)
+		}
+
+		sort.Slice(dirLinks, func(i, j int) bool { return dirLinks[i].Name < dirLinks[j].Name })
+		fmt.Printf("Linking %d executables from %s\n", len(dirLinks), binDir.Path)
+		links = append(links, dirLinks...)
+	}
+
+	return links, nil
+}
+
+// mergeBinLinks combines the links from bin-file or bin-files with those
+// found in bin-dirs, failing if two of them would get the same name.
+func mergeBinLinks(binLinks, dirLinks []BinLink) ([]BinLink, error) {
+	links := append(append([]BinLink{}, binLinks...), dirLinks...)
+
+	paths := make(map[string]string)
+	for _, link := range links {
+		if existing, ok := paths[link.Name]; ok {
+			return nil, fmt.Errorf("bin link %s would point to both %s and %s", link.Name, existing, link.Path)
+		}
+		paths[link.Name] = link.Path
+	}
+
+	return links, nil
+}
+
+// extractItem extracts a downloaded archive and then each archive named in
+// extract-nested from the files of the previous one. Path filters apply to
+// the innermost archive only.
+func extractItem(data []byte, filename string, item FetchItem, globalLimits ExtractLimits) (*ExtractionResult, error) {
+	opts := ExtractOptions{
+		ArchiveType:     item.ArchiveType,
+		StripComponents: item.StripComponents,
+		Include:         item.Include,
+		Exclude:         item.Exclude,
+		Limits:          item.GetExtractLimits(globalLimits),
+	}
+
+	for _, nested := range item.ExtractNested {
+		outerOpts := ExtractOptions{ArchiveType: opts.ArchiveType, Limits: opts.Limits}
+		result, err := ExtractArchive(data, filename, outerOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = findNestedArchive(result.Files, nested)
+		if err != nil {
+			return nil, err
+		}
+		filename = path.Base(cleanArchivePath(nested.Path))
+		opts.ArchiveType = nested.ArchiveType
+
+		fmt.Printf("Extracting nested archive %s...\n", nested.Path)
+	}
+
+	return ExtractArchive(data, filename, opts)
+}
+
+// findNestedArchive returns the contents of the inner archive, checked
+// against its hash when one is pinned.
+func findNestedArchive(files []ExtractedFile, nested NestedArchive) ([]byte, error) {
+	nestedPath := cleanArchivePath(nested.Path)
+	for _, file := range files {
+		if file.Name != nestedPath {
+			continue
+		}
+		if file.Symlink != "" {
+			return nil, fmt.Errorf("nested archive %s is a symlink", nested.Path)
+		}
+		if nested.Hash != "" {
+			if err := VerifyHash(file.Data, nested.Hash); err != nil {
+				return nil, fmt.Errorf("nested archive %s: %w", nested.Path, err)
+			}
+		}
+		return file.Data, nil
+	}
+
+	return nil, fmt.Errorf("nested archive %s not found", nested.Path)
+}
+
+// VerifyInstalledItem re-checks an installed item without downloading it.
+// Plain downloads are checked against hash/hashes, extracted items against
+// their tree-hash. It reports false when the item has nothing to check.
+func VerifyInstalledItem(config *Config, item FetchItem) (bool, error) {
+	outputDir := item.GetOutputDir(config.OutputDir)
+	if outputDir == "" {
+		return false, fmt.Errorf("output-dir not specified")
+	}
+
+	// Versioned items are checked in the directory of the configured version
+	root, installName := itemLayout(outputDir, item)
+	itemPath := filepath.Join(root, installName)
+
+	if item.Extract {
+		if item.TreeHash == "" {
+			return false, nil
+		}
+		if err := VerifyTreeHash(itemPath, item.TreeHash); err != nil {
+			return true, fmt.Errorf("tree hash verification failed: %w", err)
+		}
+		return true, nil
+	}
+
+	// The pinned hashes cover the compressed download, not the installed file
+	if item.Decompress {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(singleFilePath(itemPath, item))
+	if err != nil {
+		return true, fmt.Errorf("failed to read installed file: %w", err)
+	}
+
+	return true, verifyItemHash(data, item)
+}
+
+// verifyFileHashes checks the extracted files named in fileHashes against
+// their expected hashes. Every listed file must be present in the archive.
+func verifyFileHashes(files []ExtractedFile, fileHashes map[string]string) error {
+	filesByPath := make(map[string][]byte, len(files))
+	for _, file := range files {
+		if file.Symlink != "" {
+			continue
+		}
+		filesByPath[cleanArchivePath(file.Name)] = file.Data
+	}
+
+	filePaths := make([]string, 0, len(fileHashes))
+	for filePath := range fileHashes {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Strings(filePaths)
+
+	for _, filePath := range filePaths {
+		data, ok := filesByPath[cleanArchivePath(filePath)]
+		if !ok {
+			return fmt.Errorf("file %s not found in archive", filePath)
+		}
+		if err := VerifyHash(data, fileHashes[filePath]); err != nil {
+			return fmt.Errorf("file %s: %w", filePath, err)
 		}
 	}
 
@@ -110,68 +501,220 @@ func ProcessFetchItem(config *Config, item FetchItem) error {
 type FileToWrite struct {
 	Name string
 	Data []byte
+	// Mode is applied when the file is created, 0644 when zero
+	Mode os.FileMode
+	// Symlink is written as the link target instead of Data when set
+	Symlink string
+	// Hardlink is the path, relative to the output directory, of an earlier
+	// file to link to instead of writing Data
+	Hardlink string
+	// ModTime is applied to regular files when set
+	ModTime time.Time
 }
 
-func writeFiles(files []FileToWrite, outputDir string, isExtract bool, itemName string) error {
+// stageFiles writes files into a new staging directory inside outputDir, so
+// the later rename stays on the same filesystem. File names are relative to
+// outputDir. The caller removes the staging directory, which is returned even
+// when writing fails.
+func stageFiles(files []FileToWrite, outputDir string, itemName string) (string, error) {
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return "", fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	if isExtract {
-		extractDir := filepath.Join(outputDir, itemName)
-		if err := removeExisting(extractDir); err != nil {
-			return fmt.Errorf("failed to remove existing directory %s: %w", extractDir, err)
-		}
-	} else {
-		singleFilePath := filepath.Join(outputDir, itemName)
-		if err := removeExisting(singleFilePath); err != nil {
-			return fmt.Errorf("failed to remove existing file %s: %w", singleFilePath, err)
-		}
+	stagingDir, err := os.MkdirTemp(outputDir, "."+itemName+".staging-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
 	}
 
+	// Each created directory gets the newest modification time below it
+	dirTimes := make(map[string]time.Time)
+
 	for _, file := range files {
-		filePath := filepath.Join(outputDir, file.Name)
+		filePath, err := resolveInRoot(stagingDir, file.Name)
+		if err != nil {
+			return stagingDir, fmt.Errorf("refusing to write file: %w", err)
+		}
+		displayPath := filepath.Join(outputDir, file.Name)
 
 		fileDir := filepath.Dir(filePath)
 		if err := os.MkdirAll(fileDir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory for file %s: %w", filePath, err)
+			return stagingDir, fmt.Errorf("failed to create directory for file %s: %w", displayPath, err)
+		}
+		if !file.ModTime.IsZero() {
+			for dir := fileDir; dir != stagingDir; dir = filepath.Dir(dir) {
+				if file.ModTime.After(dirTimes[dir]) || dirTimes[dir].IsZero() {
+					dirTimes[dir] = file.ModTime
+				}
+			}
+		}
+
+		if file.Symlink != "" {
+			if err := os.Symlink(file.Symlink, filePath); err != nil {
+				return stagingDir, fmt.Errorf("failed to create symlink %s: %w", displayPath, err)
+			}
+			fmt.Printf("Linked: %s -> %s\n", displayPath, file.Symlink)
+			continue
 		}
 
-		if err := os.WriteFile(filePath, file.Data, 0644); err != nil {
-			return fmt.Errorf("failed to write file %s: %w", filePath, err)
+		if file.Hardlink != "" {
+			linkTarget, err := resolveInRoot(stagingDir, file.Hardlink)
+			if err != nil {
+				return stagingDir, fmt.Errorf("refusing to create hard link: %w", err)
+			}
+			if err := os.Link(linkTarget, filePath); err != nil {
+				return stagingDir, fmt.Errorf("failed to create hard link %s: %w", displayPath, err)
+			}
+			fmt.Printf("Linked: %s => %s\n", displayPath, filepath.Join(outputDir, file.Hardlink))
+			continue
+		}
+
+		mode := file.Mode
+		if mode == 0 {
+			mode = 0644
 		}
 
-		fmt.Printf("Written: %s\n", filePath)
+		if err := os.WriteFile(filePath, file.Data, mode); err != nil {
+			return stagingDir, fmt.Errorf("failed to write file %s: %w", displayPath, err)
+		}
+
+		if !file.ModTime.IsZero() {
+			if err := os.Chtimes(filePath, file.ModTime, file.ModTime); err != nil {
+				return stagingDir, fmt.Errorf("failed to set modification time of %s: %w", displayPath, err)
+			}
+		}
+
+		fmt.Printf("Written: %s\n", displayPath)
 	}
 
-	return nil
+	// The item is always replaced, so an extract that leaves no files installs
+	// an empty directory instead of keeping the previous version
+	itemPath := filepath.Join(stagingDir, itemName)
+	if _, err := os.Lstat(itemPath); os.IsNotExist(err) {
+		if err := os.Mkdir(itemPath, 0755); err != nil {
+			return stagingDir, fmt.Errorf("failed to create directory %s: %w", filepath.Join(outputDir, itemName), err)
+		}
+	}
+
+	// Directories are set last, deepest first, once nothing else is created
+	// inside them
+	dirs := make([]string, 0, len(dirTimes))
+	for dir := range dirTimes {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], string(filepath.Separator)) > strings.Count(dirs[j], string(filepath.Separator))
+	})
+	for _, dir := range dirs {
+		if err := os.Chtimes(dir, dirTimes[dir], dirTimes[dir]); err != nil {
+			return stagingDir, fmt.Errorf("failed to set modification time of %s: %w", dir, err)
+		}
+	}
+
+	return stagingDir, nil
 }
 
-func createSymlink(targetPath, binDir, symlinkName string) error {
-	if err := os.MkdirAll(binDir, 0755); err != nil {
-		return fmt.Errorf("failed to create bin directory: %w", err)
+// commitStaged moves everything staged into outputDir, replacing previous
+// versions. Previous versions end up in the staging directory, and the
+// returned function moves them back until the staging directory is removed.
+// If one entry fails, the ones before it are restored.
+func commitStaged(stagingDir, outputDir string) (func() error, error) {
+	entries, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staging directory: %w", err)
 	}
 
-	symlinkPath := filepath.Join(binDir, symlinkName)
+	backupDir, err := os.MkdirTemp(stagingDir, ".previous-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
 
-	if err := removeExisting(symlinkPath); err != nil {
-		return fmt.Errorf("failed to remove existing file/directory at symlink location: %w", err)
+	var committed []string
+	restore := func() error {
+		for i := len(committed) - 1; i >= 0; i-- {
+			if err := restoreFromBackup(filepath.Join(outputDir, committed[i]), filepath.Join(backupDir, committed[i])); err != nil {
+				return err
+			}
+		}
+		committed = nil
+		return nil
 	}
 
-	// Convert target path to absolute path to ensure symlink works correctly
-	absTargetPath, err := filepath.Abs(targetPath)
+	for _, entry := range entries {
+		staged := filepath.Join(stagingDir, entry.Name())
+		target := filepath.Join(outputDir, entry.Name())
+		if err := swapIntoPlace(staged, target, filepath.Join(backupDir, entry.Name())); err != nil {
+			if restoreErr := restore(); restoreErr != nil {
+				return nil, fmt.Errorf("%w (restoring the previous version also failed: %v)", err, restoreErr)
+			}
+			return nil, err
+		}
+		committed = append(committed, entry.Name())
+	}
+
+	return restore, nil
+}
+
+// swapIntoPlace renames staged to target, leaving the previous target at
+// backup so restoreFromBackup can undo the swap. Files and symlinks are
+// replaced atomically, with a hard link keeping the previous one. Renames
+// cannot replace a directory or put one in place of a file, so then the
+// existing target is moved to backup first and moved back if the second
+// rename fails.
+func swapIntoPlace(staged, target, backup string) error {
+	stagedInfo, err := os.Lstat(staged)
 	if err != nil {
-		return fmt.Errorf("failed to resolve absolute path for target: %w", err)
+		return fmt.Errorf("failed to check %s: %w", staged, err)
 	}
 
-	if err := os.Symlink(absTargetPath, symlinkPath); err != nil {
-		return fmt.Errorf("failed to create symlink: %w", err)
+	info, err := os.Lstat(target)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to check %s: %w", target, err)
 	}
 
-	if err := os.Chmod(absTargetPath, 0755); err != nil {
-		fmt.Printf("Warning: failed to make target executable: %v\n", err)
+	if err == nil && !info.IsDir() && !stagedInfo.IsDir() && os.Link(target, backup) == nil {
+		if err := os.Rename(staged, target); err != nil {
+			os.Remove(backup)
+			return fmt.Errorf("failed to install %s: %w", target, err)
+		}
+		return nil
 	}
 
-	fmt.Printf("Created symlink: %s -> %s\n", symlinkPath, absTargetPath)
+	if err == nil {
+		if err := os.Rename(target, backup); err != nil {
+			return fmt.Errorf("failed to move aside %s: %w", target, err)
+		}
+		if err := os.Rename(staged, target); err != nil {
+			if restoreErr := os.Rename(backup, target); restoreErr != nil {
+				return fmt.Errorf("failed to install %s: %w (restoring the previous version also failed: %v)", target, err, restoreErr)
+			}
+			return fmt.Errorf("failed to install %s: %w", target, err)
+		}
+		return nil
+	}
+
+	if err := os.Rename(staged, target); err != nil {
+		return fmt.Errorf("failed to install %s: %w", target, err)
+	}
+	return nil
+}
+
+// restoreFromBackup undoes swapIntoPlace: the previous target is moved back
+// from backup, or target is removed if there was none.
+func restoreFromBackup(target, backup string) error {
+	if _, err := os.Lstat(backup); os.IsNotExist(err) {
+		if err := os.RemoveAll(target); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", target, err)
+		}
+		return nil
+	}
+
+	if info, err := os.Lstat(target); err == nil && info.IsDir() {
+		if err := os.RemoveAll(target); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", target, err)
+		}
+	}
+	if err := os.Rename(backup, target); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", target, err)
+	}
 	return nil
 }
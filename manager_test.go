@@ -1,18 +1,37 @@
 package main
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
-func TestWriteFiles(t *testing.T) {
+// stageAndCommit stages files and swaps them into outputDir the way
+// ProcessFetchItem does.
+func stageAndCommit(files []FileToWrite, outputDir string, itemName string) error {
+	stagingDir, err := stageFiles(files, outputDir, itemName)
+	if stagingDir != "" {
+		defer os.RemoveAll(stagingDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = commitStaged(stagingDir, outputDir)
+	return err
+}
+
+func TestStageFiles(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
 	if err != nil {
 		t.Fatalf("Failed to create temp dir: %v", err)
@@ -30,7 +49,7 @@ func TestWriteFiles(t *testing.T) {
 		},
 	}
 
-	err = writeFiles(files, tmpDir, false, "test-item")
+	err = stageAndCommit(files, tmpDir, "test-item")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -61,7 +80,256 @@ func TestWriteFiles(t *testing.T) {
 	}
 }
 
-func TestCreateSymlink(t *testing.T) {
+func TestStageFilesAppliesModes(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := []FileToWrite{
+		{Name: "test-item/bin/tool", Data: []byte("tool"), Mode: 0755},
+		{Name: "test-item/lib/data", Data: []byte("data"), Mode: 0600},
+		{Name: "test-item/README", Data: []byte("readme")},
+	}
+
+	if err := stageAndCommit(files, tmpDir, "test-item"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]os.FileMode{
+		"bin/tool": 0755,
+		"lib/data": 0600,
+		"README":   0644,
+	}
+	for name, mode := range expected {
+		info, err := os.Stat(filepath.Join(tmpDir, "test-item", name))
+		if err != nil {
+			t.Errorf("Failed to stat %s: %v", name, err)
+			continue
+		}
+		// Only compare bits a umask of 022 leaves untouched
+		if info.Mode().Perm()&0755 != mode&0755 {
+			t.Errorf("Expected mode %v for %s, got %v", mode, name, info.Mode().Perm())
+		}
+	}
+}
+
+func TestProcessFetchItemStripSetuid(t *testing.T) {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	tarWriter.WriteHeader(&tar.Header{Name: "bin/helper", Mode: 06755, Size: 1, Typeflag: tar.TypeReg})
+	tarWriter.Write([]byte("x"))
+	tarWriter.Close()
+	tarData := buf.Bytes()
+
+	hasher := sha256.New()
+	hasher.Write(tarData)
+	expectedHash := fmt.Sprintf("sha256:%x", hasher.Sum(nil))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(tarData)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := &Config{
+		OutputDir: tmpDir,
+	}
+
+	item := FetchItem{
+		Name:        "test-item",
+		URL:         server.URL + "/archive.tar",
+		Hash:        expectedHash,
+		Extract:     true,
+		StripSetuid: true,
+	}
+
+	if err := ProcessFetchItem(config, item); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(tmpDir, "test-item", "bin", "helper"))
+	if err != nil {
+		t.Fatalf("Failed to stat extracted file: %v", err)
+	}
+
+	if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		t.Errorf("Expected setuid/setgid bits to be stripped, got %v", info.Mode())
+	}
+
+	if info.Mode()&0100 == 0 {
+		t.Errorf("Expected extracted file to stay executable, got %v", info.Mode())
+	}
+}
+
+func TestProcessFetchItemWithLinks(t *testing.T) {
+	tarData := createTestTarWithEntries([]testTarEntry{
+		{name: "pkg/lib/cli.js", typeflag: tar.TypeReg, data: "#!/bin/sh\necho cli"},
+		{name: "pkg/bin/cli", typeflag: tar.TypeSymlink, linkname: "../lib/cli.js"},
+		{name: "pkg/bin/cli-hard", typeflag: tar.TypeLink, linkname: "pkg/lib/cli.js"},
+	})
+
+	hasher := sha256.New()
+	hasher.Write(tarData)
+	expectedHash := fmt.Sprintf("sha256:%x", hasher.Sum(nil))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(tarData)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := &Config{
+		OutputDir: filepath.Join(tmpDir, "output"),
+		BinsDir:   filepath.Join(tmpDir, "bin"),
+	}
+
+	item := FetchItem{
+		Name:    "test-item",
+		URL:     server.URL + "/archive.tar",
+		Hash:    expectedHash,
+		Extract: true,
+		BinFile: "pkg/bin/cli",
+	}
+
+	if err := ProcessFetchItem(config, item); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	itemDir := filepath.Join(tmpDir, "output", "test-item")
+
+	linkTarget, err := os.Readlink(filepath.Join(itemDir, "pkg", "bin", "cli"))
+	if err != nil {
+		t.Fatalf("Expected symlink to be created: %v", err)
+	}
+	if linkTarget != "../lib/cli.js" {
+		t.Errorf("Expected symlink target '../lib/cli.js', got %q", linkTarget)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "bin", "cli"))
+	if err != nil {
+		t.Errorf("Expected bin symlink to resolve through the archive symlink: %v", err)
+	} else if string(content) != "#!/bin/sh\necho cli" {
+		t.Errorf("Unexpected content through bin symlink: %q", string(content))
+	}
+
+	originalInfo, err := os.Stat(filepath.Join(itemDir, "pkg", "lib", "cli.js"))
+	if err != nil {
+		t.Fatalf("Failed to stat original file: %v", err)
+	}
+	hardlinkInfo, err := os.Stat(filepath.Join(itemDir, "pkg", "bin", "cli-hard"))
+	if err != nil {
+		t.Fatalf("Failed to stat hard link: %v", err)
+	}
+	if !os.SameFile(originalInfo, hardlinkInfo) {
+		t.Errorf("Expected cli-hard to be a hard link to cli.js")
+	}
+
+	if _, err := TreeHash(itemDir); err != nil {
+		t.Errorf("Expected tree hash to support links: %v", err)
+	}
+}
+
+func TestStageFilesRejectsEscapingPaths(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outputDir := filepath.Join(tmpDir, "output")
+
+	files := []FileToWrite{
+		{Name: "test-item/../../escaped.txt", Data: []byte("evil")},
+	}
+
+	if err := stageAndCommit(files, outputDir, "test-item"); err == nil {
+		t.Errorf("Expected error for escaping path, but got none")
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written outside the output directory")
+	}
+}
+
+func TestPrepareBinEntriesRejectsInvalidName(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binDir := filepath.Join(tmpDir, "bin")
+
+	for _, symlinkName := range []string{"..", "../escape", "sub/name", ""} {
+		if err := installBinEntry(filepath.Join(tmpDir, "target"), binDir, symlinkName, binModeSymlink, nil); err == nil {
+			t.Errorf("Expected error for symlink name %q, but got none", symlinkName)
+		}
+	}
+
+	if _, err := os.Stat(tmpDir); err != nil {
+		t.Errorf("Expected parent directory to remain: %v", err)
+	}
+}
+
+func TestProcessFetchItemBinFileEscape(t *testing.T) {
+	zipData, err := createTestZipForManager()
+	if err != nil {
+		t.Fatalf("Failed to create test zip: %v", err)
+	}
+
+	hasher := sha256.New()
+	hasher.Write(zipData)
+	expectedHash := fmt.Sprintf("sha256:%x", hasher.Sum(nil))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(zipData)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := &Config{
+		OutputDir: filepath.Join(tmpDir, "output"),
+		BinsDir:   filepath.Join(tmpDir, "bin"),
+	}
+
+	item := FetchItem{
+		Name:    "test-item",
+		URL:     server.URL + "/testfile.zip",
+		Hash:    expectedHash,
+		Extract: true,
+		BinFile: "../../outside",
+	}
+
+	if err := ProcessFetchItem(config, item); err == nil {
+		t.Errorf("Expected error for escaping bin-file, but got none")
+	}
+
+	if _, err := os.Lstat(filepath.Join(tmpDir, "bin", "outside")); !os.IsNotExist(err) {
+		t.Errorf("Expected no symlink to be created for escaping bin-file")
+	}
+}
+
+func TestPrepareBinEntries(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
 	if err != nil {
 		t.Fatalf("Failed to create temp dir: %v", err)
@@ -79,7 +347,7 @@ func TestCreateSymlink(t *testing.T) {
 		t.Fatalf("Failed to create target file: %v", err)
 	}
 
-	err = createSymlink(targetFile, binDir, "mybinary")
+	err = installBinEntry(targetFile, binDir, "mybinary", binModeSymlink, nil)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -101,18 +369,9 @@ func TestCreateSymlink(t *testing.T) {
 		t.Errorf("Expected symlink target %q, got %q", targetFile, linkTarget)
 	}
 
-	targetInfo, err := os.Stat(targetFile)
-	if err != nil {
-		t.Errorf("Failed to stat target file: %v", err)
-		return
-	}
-
-	if targetInfo.Mode()&0111 == 0 {
-		t.Errorf("Expected target file to be executable")
-	}
 }
 
-func TestCreateSymlinkReplaceExisting(t *testing.T) {
+func TestPrepareBinEntriesReplaceExisting(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
 	if err != nil {
 		t.Fatalf("Failed to create temp dir: %v", err)
@@ -139,7 +398,7 @@ func TestCreateSymlinkReplaceExisting(t *testing.T) {
 		t.Fatalf("Failed to create existing symlink: %v", err)
 	}
 
-	err = createSymlink(targetFile, binDir, "mybinary")
+	err = installBinEntry(targetFile, binDir, "mybinary", binModeSymlink, nil)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 		return
@@ -264,15 +523,111 @@ func TestProcessFetchItemWithExtraction(t *testing.T) {
 	}
 }
 
-func TestProcessFetchItemWithBinFile(t *testing.T) {
-	testData := []byte("#!/bin/bash\necho hello")
+func TestProcessFetchItemWithFileHashes(t *testing.T) {
+	zipData, err := createTestZipForManager()
+	if err != nil {
+		t.Fatalf("Failed to create test zip: %v", err)
+	}
+
 	hasher := sha256.New()
-	hasher.Write(testData)
+	hasher.Write(zipData)
 	expectedHash := fmt.Sprintf("sha256:%x", hasher.Sum(nil))
 
+	fileHasher := sha256.New()
+	fileHasher.Write([]byte("content of extracted file"))
+	fileHash := fmt.Sprintf("sha256:%x", fileHasher.Sum(nil))
+
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-		w.Write(testData)
+		w.Write(zipData)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		fileHashes  map[string]string
+		expectError bool
+	}{
+		{
+			name:        "matching file hash",
+			fileHashes:  map[string]string{"extracted.txt": fileHash},
+			expectError: false,
+		},
+		{
+			name:        "matching file hash with ./ prefix",
+			fileHashes:  map[string]string{"./extracted.txt": fileHash},
+			expectError: false,
+		},
+		{
+			name:        "wrong file hash",
+			fileHashes:  map[string]string{"extracted.txt": expectedHash},
+			expectError: true,
+		},
+		{
+			name:        "file missing from archive",
+			fileHashes:  map[string]string{"missing.txt": fileHash},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			config := &Config{
+				OutputDir: tmpDir,
+			}
+
+			item := FetchItem{
+				Name:       "test-item",
+				URL:        server.URL + "/testfile.zip",
+				Hash:       expectedHash,
+				Extract:    true,
+				FileHashes: tt.fileHashes,
+			}
+
+			err = ProcessFetchItem(config, item)
+			extractedFilePath := filepath.Join(tmpDir, "test-item", "extracted.txt")
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				if _, err := os.Stat(extractedFilePath); !os.IsNotExist(err) {
+					t.Errorf("Expected nothing to be written on file hash failure")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if _, err := os.Stat(extractedFilePath); err != nil {
+				t.Errorf("Expected extracted file to exist at %s", extractedFilePath)
+			}
+		})
+	}
+}
+
+func TestProcessFetchItemWithTreeHash(t *testing.T) {
+	zipData, err := createTestZipForManager()
+	if err != nil {
+		t.Fatalf("Failed to create test zip: %v", err)
+	}
+
+	hasher := sha256.New()
+	hasher.Write(zipData)
+	expectedHash := fmt.Sprintf("sha256:%x", hasher.Sum(nil))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(zipData)
 	}))
 	defer server.Close()
 
@@ -282,43 +637,273 @@ func TestProcessFetchItemWithBinFile(t *testing.T) {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	outputDir := filepath.Join(tmpDir, "output")
-	binDir := filepath.Join(tmpDir, "bin")
-
 	config := &Config{
-		OutputDir: outputDir,
-		BinsDir:   binDir,
+		OutputDir: tmpDir,
 	}
 
 	item := FetchItem{
 		Name:    "test-item",
-		URL:     server.URL + "/mybinary",
+		URL:     server.URL + "/testfile.zip",
 		Hash:    expectedHash,
-		BinFile: true,
-	}
-
-	err = ProcessFetchItem(config, item)
-	if err != nil {
-		t.Errorf("Unexpected error: %v", err)
-		return
+		Extract: true,
 	}
 
-	symlinkPath := filepath.Join(binDir, "test-item")
-	if _, err := os.Lstat(symlinkPath); os.IsNotExist(err) {
-		t.Errorf("Expected symlink to exist at %s", symlinkPath)
-		return
+	if err := ProcessFetchItem(config, item); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	targetFile := filepath.Join(outputDir, "test-item")
-	linkTarget, err := os.Readlink(symlinkPath)
+	itemDir := filepath.Join(tmpDir, "test-item")
+	treeHash, err := TreeHash(itemDir)
 	if err != nil {
-		t.Errorf("Failed to read symlink: %v", err)
-		return
+		t.Fatalf("Failed to compute tree hash: %v", err)
+	}
+
+	t.Run("matching tree hash", func(t *testing.T) {
+		item.TreeHash = treeHash
+		if err := ProcessFetchItem(config, item); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		checked, err := VerifyInstalledItem(config, item)
+		if err != nil {
+			t.Errorf("Unexpected verification error: %v", err)
+		}
+		if !checked {
+			t.Errorf("Expected item to be checked")
+		}
+	})
+
+	t.Run("tampered install detected on verification", func(t *testing.T) {
+		item.TreeHash = treeHash
+		if err := os.WriteFile(filepath.Join(itemDir, "injected"), []byte("evil"), 0644); err != nil {
+			t.Fatalf("Failed to tamper with install: %v", err)
+		}
+
+		if _, err := VerifyInstalledItem(config, item); err == nil {
+			t.Errorf("Expected verification error for tampered install, but got none")
+		}
+	})
+
+	t.Run("mismatching tree hash", func(t *testing.T) {
+		item.TreeHash = "t1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+		if err := ProcessFetchItem(config, item); err == nil {
+			t.Errorf("Expected error for tree hash mismatch, but got none")
+		}
+
+		// The previous install stays in place and nothing staged is left over
+		if _, err := os.Stat(filepath.Join(itemDir, "injected")); err != nil {
+			t.Errorf("Expected previous install to be left intact: %v", err)
+		}
+		entries, err := os.ReadDir(tmpDir)
+		if err != nil {
+			t.Fatalf("Failed to read output dir: %v", err)
+		}
+		for _, entry := range entries {
+			if entry.Name() != "test-item" && entry.Name() != stateFileName {
+				t.Errorf("Unexpected entry %s left in the output dir", entry.Name())
+			}
+		}
+	})
+}
+
+func TestVerifyInstalledItemDownloadOnly(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	testData := []byte("test file content")
+	if err := os.WriteFile(filepath.Join(tmpDir, "test-item"), testData, 0644); err != nil {
+		t.Fatalf("Failed to write installed file: %v", err)
+	}
+
+	config := &Config{
+		OutputDir: tmpDir,
+	}
+
+	item := FetchItem{
+		Name: "test-item",
+		Hash: fmt.Sprintf("sha256:%x", sha256.Sum256(testData)),
+	}
+
+	if _, err := VerifyInstalledItem(config, item); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	item.Hash = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other")))
+	if _, err := VerifyInstalledItem(config, item); err == nil {
+		t.Errorf("Expected error for modified file, but got none")
+	}
+
+	extractItem := FetchItem{
+		Name:    "test-item",
+		Hash:    item.Hash,
+		Extract: true,
+	}
+	checked, err := VerifyInstalledItem(config, extractItem)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if checked {
+		t.Errorf("Expected extracted item without tree-hash to be skipped")
+	}
+}
+
+func TestProcessFetchItemWithBinFile(t *testing.T) {
+	testData := []byte("#!/bin/bash\necho hello")
+	hasher := sha256.New()
+	hasher.Write(testData)
+	expectedHash := fmt.Sprintf("sha256:%x", hasher.Sum(nil))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(testData)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outputDir := filepath.Join(tmpDir, "output")
+	binDir := filepath.Join(tmpDir, "bin")
+
+	config := &Config{
+		OutputDir: outputDir,
+		BinsDir:   binDir,
+	}
+
+	item := FetchItem{
+		Name:    "test-item",
+		URL:     server.URL + "/mybinary",
+		Hash:    expectedHash,
+		BinFile: true,
+	}
+
+	err = ProcessFetchItem(config, item)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	symlinkPath := filepath.Join(binDir, "test-item")
+	if _, err := os.Lstat(symlinkPath); os.IsNotExist(err) {
+		t.Errorf("Expected symlink to exist at %s", symlinkPath)
+		return
+	}
+
+	targetFile := filepath.Join(outputDir, "test-item")
+	linkTarget, err := os.Readlink(symlinkPath)
+	if err != nil {
+		t.Errorf("Failed to read symlink: %v", err)
+		return
 	}
 
 	if linkTarget != targetFile {
 		t.Errorf("Expected symlink target %q, got %q", targetFile, linkTarget)
 	}
+
+	targetInfo, err := os.Stat(targetFile)
+	if err != nil {
+		t.Errorf("Failed to stat target file: %v", err)
+		return
+	}
+
+	if targetInfo.Mode()&0111 == 0 {
+		t.Errorf("Expected target file to be executable")
+	}
+}
+
+func TestProcessFetchItemKeepsPreviousInstallOnBinFailure(t *testing.T) {
+	testData := []byte("#!/bin/bash\necho new")
+	expectedHash := fmt.Sprintf("sha256:%x", sha256.Sum256(testData))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(testData)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outputDir := filepath.Join(tmpDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output dir: %v", err)
+	}
+	oldPath := filepath.Join(outputDir, "test-item")
+	if err := os.WriteFile(oldPath, []byte("old"), 0755); err != nil {
+		t.Fatalf("Failed to create previous install: %v", err)
+	}
+
+	// A file where the bin directory should be cannot hold any links
+	binDir := filepath.Join(tmpDir, "bin")
+	if err := os.WriteFile(binDir, nil, 0644); err != nil {
+		t.Fatalf("Failed to create bin file: %v", err)
+	}
+
+	config := &Config{
+		OutputDir: outputDir,
+		BinsDir:   binDir,
+	}
+
+	item := FetchItem{
+		Name:    "test-item",
+		URL:     server.URL + "/mybinary",
+		Hash:    expectedHash,
+		BinFile: true,
+	}
+
+	if err := ProcessFetchItem(config, item); err == nil {
+		t.Fatalf("Expected error, but got none")
+	}
+
+	content, err := os.ReadFile(oldPath)
+	if err != nil || string(content) != "old" {
+		t.Errorf("Expected previous install to be intact, got %q (%v)", content, err)
+	}
+}
+
+func TestCommitStagedRestore(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldPath := filepath.Join(tmpDir, "test-item", "file.txt")
+	if err := stageAndCommit([]FileToWrite{{Name: "test-item/file.txt", Data: []byte("old")}}, tmpDir, "test-item"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stagingDir, err := stageFiles([]FileToWrite{{Name: "test-item/file.txt", Data: []byte("new")}}, tmpDir, "test-item")
+	if stagingDir != "" {
+		defer os.RemoveAll(stagingDir)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	restore, err := commitStaged(stagingDir, tmpDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(oldPath); string(content) != "new" {
+		t.Fatalf("Expected new content after commit, got %q", content)
+	}
+
+	if err := restore(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(oldPath); string(content) != "old" {
+		t.Errorf("Expected previous content after restore, got %q", content)
+	}
 }
 
 func TestProcessFetchItemHashVerificationFailure(t *testing.T) {
@@ -494,82 +1079,7 @@ func TestProcessFetchItemWithVersionPlaceholder(t *testing.T) {
 		t.Errorf("Expected content %q, got %q", string(testData), string(content))
 	}
 }
-func TestRemoveExisting(t *testing.T) {
-	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
-	t.Run("remove existing file", func(t *testing.T) {
-		filePath := filepath.Join(tmpDir, "test-file.txt")
-		if err := os.WriteFile(filePath, []byte("test content"), 0644); err != nil {
-			t.Fatalf("Failed to create test file: %v", err)
-		}
-
-		if err := removeExisting(filePath); err != nil {
-			t.Errorf("Unexpected error removing file: %v", err)
-		}
-
-		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
-			t.Errorf("Expected file to be removed")
-		}
-	})
-
-	t.Run("remove existing directory", func(t *testing.T) {
-		dirPath := filepath.Join(tmpDir, "test-dir")
-		if err := os.MkdirAll(dirPath, 0755); err != nil {
-			t.Fatalf("Failed to create test directory: %v", err)
-		}
-
-		testFile := filepath.Join(dirPath, "nested-file.txt")
-		if err := os.WriteFile(testFile, []byte("nested content"), 0644); err != nil {
-			t.Fatalf("Failed to create nested file: %v", err)
-		}
-
-		if err := removeExisting(dirPath); err != nil {
-			t.Errorf("Unexpected error removing directory: %v", err)
-		}
-
-		if _, err := os.Stat(dirPath); !os.IsNotExist(err) {
-			t.Errorf("Expected directory to be removed")
-		}
-	})
-
-	t.Run("remove existing symlink", func(t *testing.T) {
-		targetPath := filepath.Join(tmpDir, "target-file.txt")
-		if err := os.WriteFile(targetPath, []byte("target content"), 0644); err != nil {
-			t.Fatalf("Failed to create target file: %v", err)
-		}
-
-		symlinkPath := filepath.Join(tmpDir, "test-symlink")
-		if err := os.Symlink(targetPath, symlinkPath); err != nil {
-			t.Fatalf("Failed to create symlink: %v", err)
-		}
-
-		if err := removeExisting(symlinkPath); err != nil {
-			t.Errorf("Unexpected error removing symlink: %v", err)
-		}
-
-		if _, err := os.Lstat(symlinkPath); !os.IsNotExist(err) {
-			t.Errorf("Expected symlink to be removed")
-		}
-
-		if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-			t.Errorf("Expected target file to remain")
-		}
-	})
-
-	t.Run("remove non-existent path", func(t *testing.T) {
-		nonExistentPath := filepath.Join(tmpDir, "non-existent-file")
-
-		if err := removeExisting(nonExistentPath); err != nil {
-			t.Errorf("Unexpected error for non-existent path: %v", err)
-		}
-	})
-}
-
-func TestWriteFilesRemoval(t *testing.T) {
+func TestStageFilesRemoval(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
 	if err != nil {
 		t.Fatalf("Failed to create temp dir: %v", err)
@@ -588,7 +1098,7 @@ func TestWriteFilesRemoval(t *testing.T) {
 			{Name: itemName, Data: []byte("new content")},
 		}
 
-		if err := writeFiles(files, tmpDir, false, itemName); err != nil {
+		if err := stageAndCommit(files, tmpDir, itemName); err != nil {
 			t.Errorf("Unexpected error: %v", err)
 		}
 
@@ -619,7 +1129,7 @@ func TestWriteFilesRemoval(t *testing.T) {
 			{Name: filepath.Join(itemName, "new-file.txt"), Data: []byte("new content")},
 		}
 
-		if err := writeFiles(files, tmpDir, true, itemName); err != nil {
+		if err := stageAndCommit(files, tmpDir, itemName); err != nil {
 			t.Errorf("Unexpected error: %v", err)
 		}
 
@@ -639,7 +1149,7 @@ func TestWriteFilesRemoval(t *testing.T) {
 	})
 }
 
-func TestCreateSymlinkRemoval(t *testing.T) {
+func TestPrepareBinEntriesRemoval(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
 	if err != nil {
 		t.Fatalf("Failed to create temp dir: %v", err)
@@ -664,7 +1174,7 @@ func TestCreateSymlinkRemoval(t *testing.T) {
 			t.Fatalf("Failed to create existing file: %v", err)
 		}
 
-		if err := createSymlink(targetFile, binDir, symlinkName); err != nil {
+		if err := installBinEntry(targetFile, binDir, symlinkName, binModeSymlink, nil); err != nil {
 			t.Errorf("Unexpected error: %v", err)
 		}
 
@@ -687,7 +1197,7 @@ func TestCreateSymlinkRemoval(t *testing.T) {
 			t.Fatalf("Failed to create existing directory: %v", err)
 		}
 
-		if err := createSymlink(targetFile, binDir, symlinkName); err != nil {
+		if err := installBinEntry(targetFile, binDir, symlinkName, binModeSymlink, nil); err != nil {
 			t.Errorf("Unexpected error: %v", err)
 		}
 
@@ -701,3 +1211,751 @@ func TestCreateSymlinkRemoval(t *testing.T) {
 		}
 	})
 }
+
+func TestProcessFetchItemWithNestedArchive(t *testing.T) {
+	tarData := createTestTarWithEntries([]testTarEntry{
+		{name: "tool-1.0/bin/tool", typeflag: tar.TypeReg, data: "tool"},
+	})
+	var tarGz bytes.Buffer
+	gzipWriter := gzip.NewWriter(&tarGz)
+	gzipWriter.Write(tarData)
+	gzipWriter.Close()
+	innerHash := fmt.Sprintf("sha256:%x", sha256.Sum256(tarGz.Bytes()))
+
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	inner, err := zipWriter.Create("dist/tool-linux.tar.gz")
+	if err != nil {
+		t.Fatalf("Failed to create zip entry: %v", err)
+	}
+	inner.Write(tarGz.Bytes())
+	zipWriter.Close()
+	zipData := zipBuf.Bytes()
+	expectedHash := fmt.Sprintf("sha256:%x", sha256.Sum256(zipData))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(zipData)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		nested      NestedArchive
+		expectError bool
+	}{
+		{
+			name:        "without hash",
+			nested:      NestedArchive{Path: "dist/tool-linux.tar.gz"},
+			expectError: false,
+		},
+		{
+			name:        "with matching hash",
+			nested:      NestedArchive{Path: "./dist/tool-linux.tar.gz", Hash: innerHash},
+			expectError: false,
+		},
+		{
+			name:        "with wrong hash",
+			nested:      NestedArchive{Path: "dist/tool-linux.tar.gz", Hash: expectedHash},
+			expectError: true,
+		},
+		{
+			name:        "missing inner archive",
+			nested:      NestedArchive{Path: "dist/tool-darwin.tar.gz"},
+			expectError: true,
+		},
+		{
+			name:        "archive-type mismatch",
+			nested:      NestedArchive{Path: "dist/tool-linux.tar.gz", ArchiveType: "zip"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			config := &Config{
+				OutputDir: tmpDir,
+			}
+
+			item := FetchItem{
+				Name:            "test-item",
+				URL:             server.URL + "/bundle.zip",
+				Hash:            expectedHash,
+				Extract:         true,
+				ExtractNested:   []NestedArchive{tt.nested},
+				StripComponents: 1,
+			}
+
+			err = ProcessFetchItem(config, item)
+			toolPath := filepath.Join(tmpDir, "test-item", "bin", "tool")
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				if _, err := os.Stat(filepath.Join(tmpDir, "test-item")); !os.IsNotExist(err) {
+					t.Errorf("Expected nothing to be written on nested archive failure")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			content, err := os.ReadFile(toolPath)
+			if err != nil {
+				t.Fatalf("Expected inner archive to be extracted to %s: %v", toolPath, err)
+			}
+			if string(content) != "tool" {
+				t.Errorf("Expected content 'tool', got %q", content)
+			}
+		})
+	}
+}
+
+func TestProcessFetchItemModTimes(t *testing.T) {
+	archiveTime := time.Date(2023, 5, 17, 12, 30, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	tarWriter.WriteHeader(&tar.Header{Name: "bin/tool", Mode: 0755, Size: 1, Typeflag: tar.TypeReg, ModTime: archiveTime})
+	tarWriter.Write([]byte("x"))
+	tarWriter.Close()
+	tarData := buf.Bytes()
+
+	expectedHash := fmt.Sprintf("sha256:%x", sha256.Sum256(tarData))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(tarData)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		normalizeMtime bool
+		expected       time.Time
+	}{
+		{
+			name:     "archive mtime",
+			expected: archiveTime,
+		},
+		{
+			name:           "normalized mtime",
+			normalizeMtime: true,
+			expected:       normalizedModTime,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			config := &Config{
+				OutputDir: tmpDir,
+			}
+
+			item := FetchItem{
+				Name:           "test-item",
+				URL:            server.URL + "/archive.tar",
+				Hash:           expectedHash,
+				Extract:        true,
+				NormalizeMtime: tt.normalizeMtime,
+			}
+
+			if err := ProcessFetchItem(config, item); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Directories take the time of the newest file below them
+			for _, path := range []string{"test-item/bin/tool", "test-item/bin", "test-item"} {
+				info, err := os.Stat(filepath.Join(tmpDir, path))
+				if err != nil {
+					t.Fatalf("Failed to stat %s: %v", path, err)
+				}
+
+				if !info.ModTime().Equal(tt.expected) {
+					t.Errorf("Expected modification time %v for %s, got %v", tt.expected, path, info.ModTime())
+				}
+			}
+		})
+	}
+}
+
+func TestProcessFetchItemDecompress(t *testing.T) {
+	binaryData := []byte("#!/bin/sh\necho hello")
+
+	gzipped := func() []byte {
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		gzipWriter.Write(binaryData)
+		gzipWriter.Close()
+		return buf.Bytes()
+	}()
+	xzData, err := compressXz(binaryData)
+	if err != nil {
+		t.Fatalf("Failed to create test xz: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		filename    string
+		archiveType string
+		expectError bool
+	}{
+		{
+			name:     "gzip",
+			data:     gzipped,
+			filename: "/tool-linux-amd64.gz",
+		},
+		{
+			name:     "xz without extension",
+			data:     xzData,
+			filename: "/download",
+		},
+		{
+			name:        "archive-type agrees",
+			data:        gzipped,
+			filename:    "/tool",
+			archiveType: "gz",
+		},
+		{
+			name:        "archive-type mismatch",
+			data:        xzData,
+			filename:    "/tool.gz",
+			archiveType: "gz",
+			expectError: true,
+		},
+		{
+			name:        "not compressed",
+			data:        binaryData,
+			filename:    "/tool.gz",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write(tt.data)
+			}))
+			defer server.Close()
+
+			tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			outputDir := filepath.Join(tmpDir, "output")
+			binDir := filepath.Join(tmpDir, "bin")
+
+			config := &Config{
+				OutputDir: outputDir,
+				BinsDir:   binDir,
+			}
+
+			item := FetchItem{
+				Name:        "tool",
+				URL:         server.URL + tt.filename,
+				Hash:        fmt.Sprintf("sha256:%x", sha256.Sum256(tt.data)),
+				Decompress:  true,
+				ArchiveType: tt.archiveType,
+				BinFile:     true,
+			}
+
+			err = ProcessFetchItem(config, item)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(binDir, "tool"))
+			if err != nil {
+				t.Fatalf("Failed to read through bin symlink: %v", err)
+			}
+			if !bytes.Equal(content, binaryData) {
+				t.Errorf("Expected decompressed content %q, got %q", binaryData, content)
+			}
+		})
+	}
+}
+
+func TestProcessFetchItemReplacesWithNoFiles(t *testing.T) {
+	zipData, err := createTestZipForManager()
+	if err != nil {
+		t.Fatalf("Failed to create test zip: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(zipData)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := &Config{OutputDir: filepath.Join(tmpDir, "output")}
+	item := FetchItem{
+		Name:    "test-item",
+		URL:     server.URL + "/testfile.zip",
+		Version: "1",
+		Hash:    fmt.Sprintf("sha256:%x", sha256.Sum256(zipData)),
+		Extract: true,
+	}
+
+	if err := ProcessFetchItem(config, item); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// An include that matches nothing leaves no files to stage
+	item.Version = "2"
+	item.Include = []string{"nomatch"}
+	if err := ProcessFetchItem(config, item); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	itemDir := filepath.Join(config.OutputDir, "test-item")
+	entries, err := os.ReadDir(itemDir)
+	if err != nil {
+		t.Fatalf("Failed to read item dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected the previous version to be replaced by an empty directory, got %d entries", len(entries))
+	}
+}
+
+func TestStageFilesKeepsPreviousVersionOnFailure(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	itemName := "test-item"
+	oldFilePath := filepath.Join(tmpDir, itemName, "old-file.txt")
+	if err := os.MkdirAll(filepath.Dir(oldFilePath), 0755); err != nil {
+		t.Fatalf("Failed to create existing directory: %v", err)
+	}
+	if err := os.WriteFile(oldFilePath, []byte("old content"), 0644); err != nil {
+		t.Fatalf("Failed to create old file: %v", err)
+	}
+
+	// The second entry fails after the first one has been written
+	files := []FileToWrite{
+		{Name: filepath.Join(itemName, "new-file.txt"), Data: []byte("new content")},
+		{Name: filepath.Join(itemName, "broken-link"), Hardlink: filepath.Join(itemName, "missing")},
+	}
+
+	if err := stageAndCommit(files, tmpDir, itemName); err == nil {
+		t.Fatalf("Expected error, but got none")
+	}
+
+	content, err := os.ReadFile(oldFilePath)
+	if err != nil || string(content) != "old content" {
+		t.Errorf("Expected previous version to be intact, got %q (%v)", content, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, itemName, "new-file.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected partially written files not to be installed")
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read output dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected staging directory to be cleaned up, got %d entries", len(entries))
+	}
+}
+
+func TestPrepareBinEntriesLeavesNoStagingFiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	targetFile := filepath.Join(tmpDir, "target")
+	binDir := filepath.Join(tmpDir, "bin")
+	if err := os.WriteFile(targetFile, []byte("#!/bin/sh\necho hello"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := installBinEntry(targetFile, binDir, "mybinary", binModeSymlink, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		t.Fatalf("Failed to read bin dir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "mybinary" {
+		t.Errorf("Expected only the symlink in the bin dir, got %v", entries)
+	}
+}
+
+func TestProcessFetchItemWithBinFiles(t *testing.T) {
+	tarData := createTestTarWithEntries([]testTarEntry{
+		{name: "node/bin/node", typeflag: tar.TypeReg, data: "node"},
+		{name: "node/lib/npm-cli.js", typeflag: tar.TypeReg, data: "npm"},
+		{name: "node/bin/npm", typeflag: tar.TypeSymlink, linkname: "../lib/npm-cli.js"},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(tarData)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binDir := filepath.Join(tmpDir, "bin")
+	config := &Config{
+		OutputDir: filepath.Join(tmpDir, "output"),
+		BinsDir:   binDir,
+	}
+
+	item := FetchItem{
+		Name:    "node",
+		URL:     server.URL + "/node.tar",
+		Hash:    fmt.Sprintf("sha256:%x", sha256.Sum256(tarData)),
+		Extract: true,
+		BinFiles: map[string]interface{}{
+			"node":     "node/bin/node",
+			"npm":      "node/bin/npm",
+			"node-npm": "node/lib/npm-cli.js",
+		},
+	}
+
+	if err := ProcessFetchItem(config, item); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"node":     "node",
+		"npm":      "npm",
+		"node-npm": "npm",
+	}
+	for linkName, expectedContent := range expected {
+		content, err := os.ReadFile(filepath.Join(binDir, linkName))
+		if err != nil {
+			t.Errorf("Failed to read through bin symlink %s: %v", linkName, err)
+			continue
+		}
+		if string(content) != expectedContent {
+			t.Errorf("Expected %s to contain %q, got %q", linkName, expectedContent, content)
+		}
+	}
+}
+
+func TestBinDirLinks(t *testing.T) {
+	files := []ExtractedFile{
+		{Name: "jdk/bin/javac", Mode: 0755},
+		{Name: "jdk/bin/java", Mode: 0755},
+		{Name: "jdk/bin/jdb", Mode: 0755},
+		{Name: "jdk/bin/README", Mode: 0644},
+		{Name: "jdk/bin/java-link", Symlink: "java"},
+		{Name: "jdk/bin/java-hard", Mode: 0755, Hardlink: "jdk/bin/java"},
+		{Name: "jdk/bin/sub/tool", Mode: 0755},
+		{Name: "jdk/lib/jli", Mode: 0755},
+		{Name: "tool", Mode: 0755},
+	}
+
+	tests := []struct {
+		name          string
+		binDirs       []BinDirectory
+		expectedNames []string
+		expectError   bool
+	}{
+		{
+			name:          "all executables",
+			binDirs:       []BinDirectory{{Path: "jdk/bin"}},
+			expectedNames: []string{"java", "java-hard", "javac", "jdb"},
+		},
+		{
+			name:          "include and exclude",
+			binDirs:       []BinDirectory{{Path: "/jdk/bin/", Include: []string{"java*"}, Exclude: []string{"*-hard"}}},
+			expectedNames: []string{"java", "javac"},
+		},
+		{
+			name:          "item root",
+			binDirs:       []BinDirectory{{Path: "."}},
+			expectedNames: []string{"tool"},
+		},
+		{
+			name:          "several directories",
+			binDirs:       []BinDirectory{{Path: "jdk/bin", Include: []string{"jdb"}}, {Path: "jdk/lib"}},
+			expectedNames: []string{"jdb", "jli"},
+		},
+		{
+			name:        "missing directory",
+			binDirs:     []BinDirectory{{Path: "jdk/sbin"}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, err := binDirLinks(files, tt.binDirs)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, link := range links {
+				names = append(names, link.Name)
+			}
+			if !reflect.DeepEqual(names, tt.expectedNames) {
+				t.Errorf("Expected links %v, got %v", tt.expectedNames, names)
+			}
+		})
+	}
+}
+
+func TestProcessFetchItemWithBinDirs(t *testing.T) {
+	tarData := createTestTarWithEntries([]testTarEntry{
+		{name: "llvm/bin/clang", typeflag: tar.TypeReg, data: "clang", mode: 0755},
+		{name: "llvm/bin/lld", typeflag: tar.TypeReg, data: "lld", mode: 0755},
+		{name: "llvm/bin/notes.txt", typeflag: tar.TypeReg, data: "notes", mode: 0644},
+		{name: "llvm/libexec/lld", typeflag: tar.TypeReg, data: "other lld", mode: 0755},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(tarData)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		binDirs       []BinDirectory
+		expectedLinks []string
+		expectError   bool
+	}{
+		{
+			name:          "links executables",
+			binDirs:       []BinDirectory{{Path: "llvm/bin"}},
+			expectedLinks: []string{"clang", "lld"},
+		},
+		{
+			name:        "conflicting link names",
+			binDirs:     []BinDirectory{{Path: "llvm/bin"}, {Path: "llvm/libexec"}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			binDir := filepath.Join(tmpDir, "bin")
+			config := &Config{
+				OutputDir: filepath.Join(tmpDir, "output"),
+				BinsDir:   binDir,
+			}
+
+			item := FetchItem{
+				Name:    "llvm",
+				URL:     server.URL + "/llvm.tar",
+				Hash:    fmt.Sprintf("sha256:%x", sha256.Sum256(tarData)),
+				Extract: true,
+				BinDirs: tt.binDirs,
+			}
+
+			err = ProcessFetchItem(config, item)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				if _, statErr := os.Stat(filepath.Join(tmpDir, "output", "llvm")); !os.IsNotExist(statErr) {
+					t.Errorf("Expected nothing to be installed on conflict")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			entries, err := os.ReadDir(binDir)
+			if err != nil {
+				t.Fatalf("Failed to read bin dir: %v", err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if !reflect.DeepEqual(names, tt.expectedLinks) {
+				t.Errorf("Expected links %v, got %v", tt.expectedLinks, names)
+			}
+		})
+	}
+}
+
+func TestProcessFetchItemBinOwnership(t *testing.T) {
+	testData := []byte("#!/bin/sh\necho tool")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(testData)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		existing    func(t *testing.T, linkPath, outputDir string)
+		expectError bool
+	}{
+		{
+			name: "file of the user",
+			existing: func(t *testing.T, linkPath, outputDir string) {
+				if err := os.WriteFile(linkPath, []byte("mine"), 0755); err != nil {
+					t.Fatalf("Failed to create existing file: %v", err)
+				}
+			},
+			expectError: true,
+		},
+		{
+			name: "symlink to another item",
+			existing: func(t *testing.T, linkPath, outputDir string) {
+				if err := os.Symlink(filepath.Join(outputDir, "tool-other", "tool"), linkPath); err != nil {
+					t.Fatalf("Failed to create existing symlink: %v", err)
+				}
+			},
+			expectError: true,
+		},
+		{
+			name: "symlink into this item",
+			existing: func(t *testing.T, linkPath, outputDir string) {
+				if err := os.Symlink(filepath.Join(outputDir, "tool"), linkPath); err != nil {
+					t.Fatalf("Failed to create existing symlink: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			outputDir := filepath.Join(tmpDir, "output")
+			binDir := filepath.Join(tmpDir, "bin")
+			if err := os.MkdirAll(binDir, 0755); err != nil {
+				t.Fatalf("Failed to create bin dir: %v", err)
+			}
+			linkPath := filepath.Join(binDir, "tool")
+			tt.existing(t, linkPath, outputDir)
+			previous, _ := os.Readlink(linkPath)
+
+			config := &Config{
+				OutputDir: outputDir,
+				BinsDir:   binDir,
+			}
+			item := FetchItem{
+				Name:    "tool",
+				URL:     server.URL + "/tool",
+				Hash:    fmt.Sprintf("sha256:%x", sha256.Sum256(testData)),
+				BinFile: true,
+			}
+
+			err = ProcessFetchItem(config, item)
+			if !tt.expectError {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Expected error, but got none")
+			}
+			if target, _ := os.Readlink(linkPath); target != previous {
+				t.Errorf("Expected existing symlink to be kept, got %q", target)
+			}
+			if previous == "" {
+				if content, _ := os.ReadFile(linkPath); string(content) != "mine" {
+					t.Errorf("Expected existing file to be kept, got %q", content)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessFetchItemReplacesOwnBinCopy(t *testing.T) {
+	testData := []byte("#!/bin/sh\necho tool")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(testData)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := &Config{
+		OutputDir: filepath.Join(tmpDir, "output"),
+		BinsDir:   filepath.Join(tmpDir, "bin"),
+		BinMode:   binModeCopy,
+		Force:     true,
+	}
+	item := FetchItem{
+		Name:    "tool",
+		URL:     server.URL + "/tool",
+		Hash:    fmt.Sprintf("sha256:%x", sha256.Sum256(testData)),
+		BinFile: true,
+	}
+
+	// Copies do not point into the item, so only the state file shows that
+	// the second install may replace the first one's copy
+	for i := 0; i < 2; i++ {
+		if err := ProcessFetchItem(config, item); err != nil {
+			t.Fatalf("Unexpected error on install %d: %v", i+1, err)
+		}
+	}
+}
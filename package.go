@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	arMagic        = "!<arch>\n"
+	arHeaderSize   = 60
+	rpmLeadSize    = 96
+	rpmHeaderMagic = "\x8e\xad\xe8\x01"
+	cpioNewcMagic  = "070701"
+	cpioCrcMagic   = "070702"
+	cpioHeaderSize = 110
+	cpioTrailer    = "TRAILER!!!"
+)
+
+var rpmLeadMagic = []byte{0xed, 0xab, 0xee, 0xdb}
+
+// extractDeb extracts the data tarball of a Debian package. A .deb is an ar
+// archive holding "debian-binary", the control tarball and the data tarball;
+// only the data tarball ends up in the item directory.
+func extractDeb(data []byte, limits ExtractLimits) (*ExtractionResult, error) {
+	if !bytes.HasPrefix(data, []byte(arMagic)) {
+		return nil, fmt.Errorf("failed to open deb package: missing ar header")
+	}
+
+	offset := len(arMagic)
+	for offset < len(data) {
+		if len(data)-offset < arHeaderSize {
+			return nil, fmt.Errorf("failed to open deb package: truncated ar member header")
+		}
+		header := data[offset : offset+arHeaderSize]
+		if string(header[58:60]) != "`\n" {
+			return nil, fmt.Errorf("failed to open deb package: malformed ar member header")
+		}
+
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 || size > int64(len(data)-offset-arHeaderSize) {
+			return nil, fmt.Errorf("failed to open deb package: invalid size for ar member %q", name)
+		}
+
+		start := offset + arHeaderSize
+		member := data[start : start+int(size)]
+		if strings.HasPrefix(name, "data.tar") {
+			result, err := readPackageTar(member, limits)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s from deb package: %w", name, err)
+			}
+			return result, nil
+		}
+
+		// Members are aligned to two bytes
+		offset = start + int(size) + int(size%2)
+	}
+
+	return nil, fmt.Errorf("failed to open deb package: no data.tar member found")
+}
+
+// readPackageTar reads a possibly compressed tarball from a package, with
+// absolute symlink targets resolved against the extraction directory.
+func readPackageTar(data []byte, limits ExtractLimits) (*ExtractionResult, error) {
+	links := newArchiveLinks()
+	links.rootedSymlinks = true
+	budget := newExtractBudget(limits, len(data))
+
+	reader, err := openPackagePayload(data)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return readTar(reader, budget, links)
+}
+
+// openPackagePayload returns a reader for package contents that may be stored
+// uncompressed or with any of the supported compressions.
+func openPackagePayload(data []byte) (io.ReadCloser, error) {
+	compression := sniffFormat(data)
+	switch compression {
+	case "gz", "xz", "zst", "bz2":
+		reader, err := openDecompressor(compression, bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s reader: %w", compressionNames[compression], err)
+		}
+		return reader, nil
+	case "", "tar":
+		return io.NopCloser(bytes.NewReader(data)), nil
+	default:
+		return nil, fmt.Errorf("unsupported payload format: %s", compression)
+	}
+}
+
+// extractRpm extracts the cpio payload of an RPM package. The payload follows
+// the 96 byte lead, the signature header padded to eight bytes and the main
+// header.
+func extractRpm(data []byte, limits ExtractLimits) (*ExtractionResult, error) {
+	if len(data) < rpmLeadSize || !bytes.HasPrefix(data, rpmLeadMagic) {
+		return nil, fmt.Errorf("failed to open rpm package: missing lead")
+	}
+
+	offset := rpmLeadSize
+	signatureSize, err := rpmHeaderSize(data, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rpm package: signature header: %w", err)
+	}
+	offset += signatureSize
+	offset += (8 - offset%8) % 8
+
+	headerSize, err := rpmHeaderSize(data, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rpm package: main header: %w", err)
+	}
+	offset += headerSize
+
+	payload := data[offset:]
+	reader, err := openPackagePayload(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rpm payload: %w", err)
+	}
+	defer reader.Close()
+
+	result, err := readCpio(reader, newExtractBudget(limits, len(payload)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rpm payload: %w", err)
+	}
+
+	return result, nil
+}
+
+// rpmHeaderSize returns the length of the header structure at offset: a
+// 16 byte preamble, 16 bytes per index entry and the data store.
+func rpmHeaderSize(data []byte, offset int) (int, error) {
+	if offset < 0 || len(data)-offset < 16 {
+		return 0, fmt.Errorf("truncated header")
+	}
+	preamble := data[offset : offset+16]
+	if string(preamble[0:4]) != rpmHeaderMagic {
+		return 0, fmt.Errorf("bad header magic")
+	}
+
+	entries := int64(binary.BigEndian.Uint32(preamble[8:12]))
+	storeSize := int64(binary.BigEndian.Uint32(preamble[12:16]))
+	size := 16 + entries*16 + storeSize
+	if size > int64(len(data)-offset) {
+		return 0, fmt.Errorf("truncated header")
+	}
+
+	return int(size), nil
+}
+
+// readCpio extracts a cpio archive in the "newc" format used by RPM. Hard
+// linked files share an inode; the data is stored with the last of them.
+func readCpio(r io.Reader, budget *extractBudget) (*ExtractionResult, error) {
+	reader := bufio.NewReader(r)
+	links := newArchiveLinks()
+	links.rootedSymlinks = true
+
+	var files []ExtractedFile
+	pendingLinks := make(map[uint64][]ExtractedFile)
+	var read int64
+
+	for {
+		header := make([]byte, cpioHeaderSize)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil, fmt.Errorf("failed to read cpio header: %w", err)
+		}
+		read += cpioHeaderSize
+
+		magic := string(header[0:6])
+		if magic != cpioNewcMagic && magic != cpioCrcMagic {
+			return nil, fmt.Errorf("unsupported cpio format %q", magic)
+		}
+
+		fields := make([]uint64, 13)
+		for i := range fields {
+			value, err := strconv.ParseUint(string(header[6+i*8:14+i*8]), 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("malformed cpio header: %w", err)
+			}
+			fields[i] = value
+		}
+		inode, mode, nlink, modTime, fileSize, nameSize := fields[0], fields[1], fields[4], fields[5], int64(fields[6]), int64(fields[11])
+
+		if nameSize == 0 || nameSize > 4096 {
+			return nil, fmt.Errorf("malformed cpio header: invalid name size %d", nameSize)
+		}
+		nameData := make([]byte, nameSize)
+		if _, err := io.ReadFull(reader, nameData); err != nil {
+			return nil, fmt.Errorf("failed to read cpio entry name: %w", err)
+		}
+		read += nameSize
+		if err := skipCpioPadding(reader, &read); err != nil {
+			return nil, err
+		}
+
+		rawName := strings.TrimRight(string(nameData), "\x00")
+		if rawName == cpioTrailer {
+			break
+		}
+
+		if err := budget.addEntry(); err != nil {
+			return nil, fmt.Errorf("cpio archive over limit: %w", err)
+		}
+
+		entryData, err := budget.readEntry(rawName, io.LimitReader(reader, fileSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s from cpio: %w", rawName, err)
+		}
+		if int64(len(entryData)) != fileSize {
+			return nil, fmt.Errorf("failed to read file %s from cpio: %w", rawName, io.ErrUnexpectedEOF)
+		}
+		read += fileSize
+		if err := skipCpioPadding(reader, &read); err != nil {
+			return nil, err
+		}
+
+		fileType := mode & 0170000
+		if fileType != 0100000 && fileType != 0120000 {
+			continue
+		}
+
+		name, err := sanitizeArchivePath(rawName)
+		if err != nil {
+			return nil, fmt.Errorf("unsafe entry in cpio archive: %w", err)
+		}
+
+		if fileType == 0120000 {
+			symlink, err := links.addSymlink(name, string(entryData))
+			if err != nil {
+				return nil, fmt.Errorf("unsafe entry in cpio archive: %w", err)
+			}
+			files = append(files, symlink)
+			continue
+		}
+
+		extractedFile := ExtractedFile{
+			Name:    name,
+			Data:    entryData,
+			Mode:    os.FileMode(mode) & os.ModePerm,
+			ModTime: time.Unix(int64(modTime), 0),
+		}
+		if mode&04000 != 0 {
+			extractedFile.Mode |= os.ModeSetuid
+		}
+		if mode&02000 != 0 {
+			extractedFile.Mode |= os.ModeSetgid
+		}
+
+		// Earlier names of a hard linked file carry no data
+		if nlink > 1 && fileSize == 0 {
+			pendingLinks[inode] = append(pendingLinks[inode], extractedFile)
+			continue
+		}
+
+		if err := links.addFile(extractedFile); err != nil {
+			return nil, fmt.Errorf("unsafe entry in cpio archive: %w", err)
+		}
+		files = append(files, extractedFile)
+
+		for _, pending := range pendingLinks[inode] {
+			hardlink, err := links.addHardlink(pending.Name, name)
+			if err != nil {
+				return nil, fmt.Errorf("unsafe entry in cpio archive: %w", err)
+			}
+			files = append(files, hardlink)
+		}
+		delete(pendingLinks, inode)
+	}
+
+	// Hard links whose data never arrived are empty files
+	inodes := make([]uint64, 0, len(pendingLinks))
+	for inode := range pendingLinks {
+		inodes = append(inodes, inode)
+	}
+	sort.Slice(inodes, func(i, j int) bool { return inodes[i] < inodes[j] })
+	for _, inode := range inodes {
+		for _, pending := range pendingLinks[inode] {
+			if err := links.addFile(pending); err != nil {
+				return nil, fmt.Errorf("unsafe entry in cpio archive: %w", err)
+			}
+			files = append(files, pending)
+		}
+	}
+
+	return &ExtractionResult{Files: files}, nil
+}
+
+// skipCpioPadding consumes the padding that aligns newc headers and data to
+// four bytes.
+func skipCpioPadding(reader *bufio.Reader, read *int64) error {
+	padding := (4 - *read%4) % 4
+	if _, err := reader.Discard(int(padding)); err != nil {
+		return fmt.Errorf("failed to read cpio padding: %w", err)
+	}
+	*read += padding
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// createTestDeb builds a .deb with a gzip compressed data tarball.
+func createTestDeb(t *testing.T, entries []testTarEntry) []byte {
+	t.Helper()
+
+	var dataTar bytes.Buffer
+	gzipWriter := gzip.NewWriter(&dataTar)
+	gzipWriter.Write(createTestTarWithEntries(entries))
+	gzipWriter.Close()
+
+	members := []struct {
+		name string
+		data []byte
+	}{
+		{name: "debian-binary", data: []byte("2.0\n")},
+		{name: "control.tar.gz", data: createTestTarGzForPackage(t)},
+		{name: "data.tar.gz", data: dataTar.Bytes()},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(arMagic)
+	for _, member := range members {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.data))
+		buf.Write(member.data)
+		if len(member.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func createTestTarGzForPackage(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	gzipWriter.Write(createTestTarWithEntries([]testTarEntry{
+		{name: "./control", typeflag: tar.TypeReg, data: "Package: tool\n"},
+	}))
+	gzipWriter.Close()
+
+	return buf.Bytes()
+}
+
+type testCpioEntry struct {
+	name  string
+	mode  uint32
+	inode uint32
+	nlink uint32
+	data  string
+}
+
+func writeCpioEntry(buf *bytes.Buffer, entry testCpioEntry) {
+	name := entry.name + "\x00"
+	fmt.Fprintf(buf, "%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		cpioNewcMagic, entry.inode, entry.mode, 0, 0, entry.nlink, 0, len(entry.data), 0, 0, 0, 0, len(name), 0)
+	buf.WriteString(name)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	buf.WriteString(entry.data)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+func writeRpmHeader(buf *bytes.Buffer, storeSize int) {
+	buf.WriteString(rpmHeaderMagic)
+	buf.Write([]byte{0, 0, 0, 0})
+	binary.Write(buf, binary.BigEndian, uint32(1))
+	binary.Write(buf, binary.BigEndian, uint32(storeSize))
+	buf.Write(make([]byte, 16+storeSize))
+}
+
+// createTestRpm builds an RPM with an empty index and a gzip compressed cpio
+// payload.
+func createTestRpm(entries []testCpioEntry) []byte {
+	var cpio bytes.Buffer
+	for _, entry := range entries {
+		writeCpioEntry(&cpio, entry)
+	}
+	writeCpioEntry(&cpio, testCpioEntry{name: cpioTrailer, nlink: 1})
+
+	var buf bytes.Buffer
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	buf.Write(lead)
+	writeRpmHeader(&buf, 5)
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+	writeRpmHeader(&buf, 3)
+
+	gzipWriter := gzip.NewWriter(&buf)
+	gzipWriter.Write(cpio.Bytes())
+	gzipWriter.Close()
+
+	return buf.Bytes()
+}
+
+func TestExtractDeb(t *testing.T) {
+	debData := createTestDeb(t, []testTarEntry{
+		{name: "./usr/bin/tool", typeflag: tar.TypeReg, data: "tool"},
+		{name: "./usr/lib/tool/helper", typeflag: tar.TypeReg, data: "helper"},
+		{name: "./usr/bin/helper", typeflag: tar.TypeSymlink, linkname: "/usr/lib/tool/helper"},
+	})
+
+	result, err := ExtractArchive(debData, "tool_1.0_amd64.deb", ExtractOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	files := make(map[string]ExtractedFile)
+	for _, file := range result.Files {
+		files[file.Name] = file
+	}
+
+	if len(files) != 3 {
+		t.Errorf("Expected 3 files from the data tarball, got %d: %v", len(files), files)
+	}
+	if string(files["usr/bin/tool"].Data) != "tool" {
+		t.Errorf("Expected usr/bin/tool with content 'tool', got %+v", files["usr/bin/tool"])
+	}
+	if files["usr/bin/helper"].Symlink != "../../usr/lib/tool/helper" {
+		t.Errorf("Expected absolute symlink target to be made relative, got %q", files["usr/bin/helper"].Symlink)
+	}
+	if _, ok := files["control"]; ok {
+		t.Errorf("Expected control tarball to be skipped")
+	}
+}
+
+func TestExtractDebWithoutDataMember(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(arMagic)
+	fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", "debian-binary", 0, 0, 0, "100644", 4)
+	buf.WriteString("2.0\n")
+
+	if _, err := extractDeb(buf.Bytes(), ExtractLimits{}); err == nil {
+		t.Errorf("Expected error, but got none")
+	}
+}
+
+func TestExtractRpm(t *testing.T) {
+	rpmData := createTestRpm([]testCpioEntry{
+		{name: "./usr", mode: 040755, inode: 1, nlink: 2},
+		{name: "./usr/bin/tool", mode: 0100755, inode: 2, nlink: 1, data: "tool"},
+		{name: "./usr/bin/tool-link", mode: 0100755, inode: 3, nlink: 2},
+		{name: "./usr/bin/tool-copy", mode: 0100755, inode: 3, nlink: 2, data: "shared"},
+		{name: "./usr/bin/alias", mode: 0120777, inode: 4, nlink: 1, data: "/usr/bin/tool"},
+	})
+
+	result, err := ExtractArchive(rpmData, "tool-1.0-1.x86_64.rpm", ExtractOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	files := make(map[string]ExtractedFile)
+	for _, file := range result.Files {
+		files[file.Name] = file
+	}
+
+	if len(files) != 4 {
+		t.Errorf("Expected 4 entries, got %d: %v", len(files), files)
+	}
+	if tool := files["usr/bin/tool"]; string(tool.Data) != "tool" || tool.Mode != 0755 {
+		t.Errorf("Expected usr/bin/tool with content 'tool' and mode 0755, got %+v", tool)
+	}
+	if link := files["usr/bin/tool-link"]; link.Hardlink != "usr/bin/tool-copy" || string(link.Data) != "shared" {
+		t.Errorf("Expected usr/bin/tool-link to be a hard link to usr/bin/tool-copy, got %+v", link)
+	}
+	if files["usr/bin/alias"].Symlink != "../../usr/bin/tool" {
+		t.Errorf("Expected absolute symlink target to be made relative, got %q", files["usr/bin/alias"].Symlink)
+	}
+}
+
+func TestExtractRpmRejectsUnsafePaths(t *testing.T) {
+	rpmData := createTestRpm([]testCpioEntry{
+		{name: "../../etc/passwd", mode: 0100644, inode: 1, nlink: 1, data: "x"},
+	})
+
+	if _, err := extractRpm(rpmData, ExtractLimits{}); err == nil {
+		t.Errorf("Expected error, but got none")
+	}
+}
+
+func TestExtractRpmTruncated(t *testing.T) {
+	rpmData := createTestRpm([]testCpioEntry{
+		{name: "./usr/bin/tool", mode: 0100755, inode: 1, nlink: 1, data: "tool"},
+	})
+
+	if _, err := extractRpm(rpmData[:rpmLeadSize+20], ExtractLimits{}); err == nil {
+		t.Errorf("Expected error, but got none")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateFileName is the file in each output directory that records what vfetch
+// installed there.
+const stateFileName = ".vfetch-state.json"
+
+// InstallState is the content of the state file, keyed by item name.
+type InstallState struct {
+	Items map[string]ItemState `json:"items"`
+}
+
+// ItemState records one installed item. Settings is a digest of the item
+// configuration, so any change to it reinstalls the item; TreeHash is the tree
+// hash of Path right after the install, to notice changes on disk.
+type ItemState struct {
+	URL         string         `json:"url"`
+	Version     string         `json:"version"`
+	Hash        string         `json:"hash"`
+	Settings    string         `json:"settings"`
+	Path        string         `json:"path"`
+	TreeHash    string         `json:"tree-hash"`
+	BinLinks    []BinLinkState `json:"bin-links"`
+	InstalledAt time.Time      `json:"installed-at"`
+}
+
+// BinLinkState records a bin entry and the absolute path of the file it runs.
+type BinLinkState struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+func loadInstallState(outputDir string) (*InstallState, error) {
+	state := &InstallState{Items: make(map[string]ItemState)}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, stateFileName))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	if state.Items == nil {
+		state.Items = make(map[string]ItemState)
+	}
+
+	return state, nil
+}
+
+// saveInstallState writes the state file under a temporary name and renames
+// it into place, so an interrupted write never leaves a truncated file.
+func saveInstallState(outputDir string, state *InstallState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(outputDir, "."+stateFileName+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(append(data, '\n')); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), filepath.Join(outputDir, stateFileName)); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return nil
+}
+
+// itemSettings returns a digest of everything in the configuration that
+// affects how an item is installed, including the global defaults it uses.
+func itemSettings(config *Config, item FetchItem) (string, error) {
+	data, err := json.Marshal(struct {
+		Item          FetchItem     `json:"item"`
+		OutputDir     string        `json:"output-dir"`
+		BinDir        string        `json:"bin-dir"`
+		BinMode       string        `json:"bin-mode"`
+		ExtractLimits ExtractLimits `json:"extract-limits"`
+		KeepVersions  int           `json:"keep-versions"`
+	}{
+		Item:          item,
+		OutputDir:     item.GetOutputDir(config.OutputDir),
+		BinDir:        item.GetBinDir(config.BinsDir),
+		BinMode:       item.GetBinMode(config.BinMode),
+		ExtractLimits: item.GetExtractLimits(config.ExtractLimits),
+		KeepVersions:  item.GetKeepVersions(config.KeepVersions),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode item settings: %w", err)
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data)), nil
+}
+
+// recordInstall stores the state of an item that was just installed.
+func recordInstall(config *Config, item FetchItem, data []byte, binLinks []BinLinkState) error {
+	outputDir := item.GetOutputDir(config.OutputDir)
+	root, installName := itemLayout(outputDir, item)
+	itemPath := filepath.Join(root, installName)
+
+	settings, err := itemSettings(config, item)
+	if err != nil {
+		return err
+	}
+
+	treeHash, err := TreeHash(itemPath)
+	if err != nil {
+		return err
+	}
+
+	// A state file that cannot be read is replaced rather than blocking installs
+	state, err := loadInstallState(outputDir)
+	if err != nil {
+		fmt.Printf("Warning: %v, starting a new one\n", err)
+		state = &InstallState{Items: make(map[string]ItemState)}
+	}
+
+	state.Items[item.Name] = ItemState{
+		URL:         replaceVersionPlaceholders(item.URL, item.Version),
+		Version:     item.Version,
+		Hash:        fmt.Sprintf("sha256:%x", sha256.Sum256(data)),
+		Settings:    settings,
+		Path:        itemPath,
+		TreeHash:    treeHash,
+		BinLinks:    binLinks,
+		InstalledAt: time.Now().UTC(),
+	}
+
+	return saveInstallState(outputDir, state)
+}
+
+// installedBinLinks returns the bin entries recorded for an item, which it
+// may replace on the next install.
+func installedBinLinks(outputDir, itemName string) map[string]bool {
+	owned := make(map[string]bool)
+	if outputDir == "" {
+		return owned
+	}
+
+	state, err := loadInstallState(outputDir)
+	if err != nil {
+		return owned
+	}
+	for _, binLink := range state.Items[itemName].BinLinks {
+		owned[binLink.Path] = true
+	}
+	return owned
+}
+
+// isUpToDate reports whether an item is installed with its current settings
+// and unchanged on disk, so downloading it again can be skipped. Any doubt,
+// including an unreadable state file, means it is not up to date.
+func isUpToDate(config *Config, item FetchItem) bool {
+	outputDir := item.GetOutputDir(config.OutputDir)
+	if outputDir == "" {
+		return false
+	}
+
+	state, err := loadInstallState(outputDir)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return false
+	}
+
+	itemState, ok := state.Items[item.Name]
+	if !ok {
+		return false
+	}
+
+	settings, err := itemSettings(config, item)
+	if err != nil || settings != itemState.Settings {
+		return false
+	}
+
+	if item.Versioned {
+		current, err := os.Readlink(filepath.Join(outputDir, item.Name, currentLink))
+		if err != nil || current != item.Version {
+			return false
+		}
+	}
+
+	// Bin entries must still run this install, not merely exist
+	itemRoot, err := filepath.EvalSymlinks(itemState.Path)
+	if err != nil {
+		return false
+	}
+	binEnv, err := itemBinEnv(item, installedItemPath(outputDir, item))
+	if err != nil {
+		return false
+	}
+	for _, binLink := range itemState.BinLinks {
+		resolved, err := filepath.EvalSymlinks(binLink.Target)
+		if err != nil || !pathWithin(resolved, itemRoot) {
+			return false
+		}
+		if err := checkBinEntry(binLink.Path, binLink.Target, item.GetBinMode(config.BinMode), binEnv); err != nil {
+			return false
+		}
+	}
+
+	treeHash, err := TreeHash(itemState.Path)
+	if err != nil || treeHash != itemState.TreeHash {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessFetchItemUpToDate(t *testing.T) {
+	zipData, err := createTestZipForManager()
+	if err != nil {
+		t.Fatalf("Failed to create test zip: %v", err)
+	}
+	expectedHash := fmt.Sprintf("sha256:%x", sha256.Sum256(zipData))
+
+	tests := []struct {
+		name            string
+		binMode         string
+		change          func(t *testing.T, config *Config, item *FetchItem, itemDir string)
+		expectDownloads int
+	}{
+		{
+			name:            "unchanged",
+			change:          func(t *testing.T, config *Config, item *FetchItem, itemDir string) {},
+			expectDownloads: 1,
+		},
+		{
+			name: "force",
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				config.Force = true
+			},
+			expectDownloads: 2,
+		},
+		{
+			name: "settings changed",
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				item.StripSetuid = true
+			},
+			expectDownloads: 2,
+		},
+		{
+			name: "global default changed",
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				config.BinMode = binModeCopy
+			},
+			expectDownloads: 2,
+		},
+		{
+			name: "tree modified",
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				if err := os.WriteFile(filepath.Join(itemDir, "injected"), []byte("evil"), 0644); err != nil {
+					t.Fatalf("Failed to tamper with install: %v", err)
+				}
+			},
+			expectDownloads: 2,
+		},
+		{
+			name: "bin link removed",
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				if err := os.Remove(filepath.Join(config.BinsDir, "extracted.txt")); err != nil {
+					t.Fatalf("Failed to remove bin link: %v", err)
+				}
+			},
+			expectDownloads: 2,
+		},
+		{
+			name: "bin link repointed",
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				linkPath := filepath.Join(config.BinsDir, "extracted.txt")
+				other := filepath.Join(config.OutputDir, "other.txt")
+				if err := os.WriteFile(other, []byte("other"), 0755); err != nil {
+					t.Fatalf("Failed to create other file: %v", err)
+				}
+				if err := os.Remove(linkPath); err != nil {
+					t.Fatalf("Failed to remove bin link: %v", err)
+				}
+				if err := os.Symlink(other, linkPath); err != nil {
+					t.Fatalf("Failed to repoint bin link: %v", err)
+				}
+			},
+			expectDownloads: 2,
+		},
+		{
+			name:    "hard link replaced by a copy",
+			binMode: binModeHardlink,
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				linkPath := filepath.Join(config.BinsDir, "extracted.txt")
+				content, err := os.ReadFile(linkPath)
+				if err != nil {
+					t.Fatalf("Failed to read hard link: %v", err)
+				}
+				if err := os.Remove(linkPath); err != nil {
+					t.Fatalf("Failed to remove hard link: %v", err)
+				}
+				if err := os.WriteFile(linkPath, content, 0755); err != nil {
+					t.Fatalf("Failed to write copy: %v", err)
+				}
+			},
+			expectDownloads: 2,
+		},
+		{
+			name:    "copy modified",
+			binMode: binModeCopy,
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				if err := os.WriteFile(filepath.Join(config.BinsDir, "extracted.txt"), []byte("evil"), 0755); err != nil {
+					t.Fatalf("Failed to modify copy: %v", err)
+				}
+			},
+			expectDownloads: 2,
+		},
+		{
+			name:    "shim modified",
+			binMode: binModeShim,
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				if err := os.WriteFile(filepath.Join(config.BinsDir, "extracted.txt"), []byte("#!/bin/sh\nexec /bin/true\n"), 0755); err != nil {
+					t.Fatalf("Failed to modify shim: %v", err)
+				}
+			},
+			expectDownloads: 2,
+		},
+		{
+			name:            "unchanged copy",
+			binMode:         binModeCopy,
+			change:          func(t *testing.T, config *Config, item *FetchItem, itemDir string) {},
+			expectDownloads: 1,
+		},
+		{
+			name:            "unchanged hard link",
+			binMode:         binModeHardlink,
+			change:          func(t *testing.T, config *Config, item *FetchItem, itemDir string) {},
+			expectDownloads: 1,
+		},
+		{
+			name:            "unchanged shim",
+			binMode:         binModeShim,
+			change:          func(t *testing.T, config *Config, item *FetchItem, itemDir string) {},
+			expectDownloads: 1,
+		},
+		{
+			name: "state file corrupted",
+			change: func(t *testing.T, config *Config, item *FetchItem, itemDir string) {
+				if err := os.WriteFile(filepath.Join(config.OutputDir, stateFileName), []byte("{"), 0644); err != nil {
+					t.Fatalf("Failed to corrupt state file: %v", err)
+				}
+			},
+			expectDownloads: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			downloads := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				downloads++
+				w.WriteHeader(http.StatusOK)
+				w.Write(zipData)
+			}))
+			defer server.Close()
+
+			tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			config := &Config{
+				OutputDir: filepath.Join(tmpDir, "output"),
+				BinsDir:   filepath.Join(tmpDir, "bin"),
+				BinMode:   tt.binMode,
+			}
+
+			item := FetchItem{
+				Name:    "test-item",
+				URL:     server.URL + "/testfile.zip",
+				Version: "1.0",
+				Hash:    expectedHash,
+				Extract: true,
+				BinFile: "extracted.txt",
+			}
+
+			if err := ProcessFetchItem(config, item); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			tt.change(t, config, &item, filepath.Join(config.OutputDir, "test-item"))
+
+			if err := ProcessFetchItem(config, item); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if downloads != tt.expectDownloads {
+				t.Errorf("Expected %d downloads, got %d", tt.expectDownloads, downloads)
+			}
+
+			if !isUpToDate(&Config{OutputDir: config.OutputDir, BinsDir: config.BinsDir, BinMode: config.BinMode}, item) {
+				t.Errorf("Expected item to be up to date after installing")
+			}
+		})
+	}
+}
+
+func TestRecordInstall(t *testing.T) {
+	data := []byte("tool")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outputDir := filepath.Join(tmpDir, "output")
+	binDir := filepath.Join(tmpDir, "bin")
+	config := &Config{OutputDir: outputDir, BinsDir: binDir}
+
+	item := FetchItem{
+		Name:    "tool",
+		URL:     server.URL + "/tool-$version",
+		Version: "2.0",
+		Hashes:  []string{fmt.Sprintf("sha256:%x", sha256.Sum256(data))},
+		BinFile: true,
+	}
+
+	if err := ProcessFetchItem(config, item); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	state, err := loadInstallState(outputDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	itemState, ok := state.Items["tool"]
+	if !ok {
+		t.Fatalf("Expected state for tool, got %v", state.Items)
+	}
+	if itemState.URL != server.URL+"/tool-2.0" {
+		t.Errorf("Expected URL with version substituted, got %s", itemState.URL)
+	}
+	if itemState.Version != "2.0" {
+		t.Errorf("Expected version 2.0, got %s", itemState.Version)
+	}
+	if itemState.Hash != fmt.Sprintf("sha256:%x", sha256.Sum256(data)) {
+		t.Errorf("Unexpected hash %s", itemState.Hash)
+	}
+	if itemState.Path != filepath.Join(outputDir, "tool") {
+		t.Errorf("Unexpected path %s", itemState.Path)
+	}
+	absTarget, err := filepath.Abs(filepath.Join(outputDir, "tool"))
+	if err != nil {
+		t.Fatalf("Failed to resolve target: %v", err)
+	}
+	if len(itemState.BinLinks) != 1 || itemState.BinLinks[0] != (BinLinkState{Path: filepath.Join(binDir, "tool"), Target: absTarget}) {
+		t.Errorf("Unexpected bin links %v", itemState.BinLinks)
+	}
+
+	treeHash, err := TreeHash(itemState.Path)
+	if err != nil {
+		t.Fatalf("Failed to compute tree hash: %v", err)
+	}
+	if itemState.TreeHash != treeHash {
+		t.Errorf("Expected tree hash %s, got %s", treeHash, itemState.TreeHash)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const treeHashPrefix = "t1:"
+
+// TreeHash computes a deterministic hash over the files below dir, similar to
+// Go's dirhash "h1:" format. Each file contributes one line with the SHA-256
+// of its contents, its mode normalized to 0644 or 0755 and its slash-separated
+// path; symlinks contribute the SHA-256 of their target and "link". The sorted
+// lines are hashed again with SHA-256.
+func TreeHash(dir string) (string, error) {
+	var lines []string
+
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if strings.Contains(relPath, "\n") {
+			return fmt.Errorf("file name %q contains a newline", relPath)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		// Symlinks contribute the hash of their target instead of contents
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, fmt.Sprintf("%x  link  %s\n", sha256.Sum256([]byte(target)), relPath))
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("unsupported file type for %s: %s", relPath, info.Mode().Type())
+		}
+
+		sum, err := hashFileSHA256(filePath)
+		if err != nil {
+			return err
+		}
+
+		mode := os.FileMode(0644)
+		if info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+
+		lines = append(lines, fmt.Sprintf("%x  %04o  %s\n", sum, mode, relPath))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash tree %s: %w", dir, err)
+	}
+
+	sort.Strings(lines)
+
+	summary := sha256.New()
+	for _, line := range lines {
+		io.WriteString(summary, line)
+	}
+
+	return treeHashPrefix + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+func hashFileSHA256(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, err
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+func decodeTreeHash(treeHash string) ([]byte, error) {
+	value, found := strings.CutPrefix(treeHash, treeHashPrefix)
+	if !found {
+		return nil, fmt.Errorf("tree hash must start with %q", treeHashPrefix)
+	}
+
+	digest, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("tree hash %q is not a base64 encoded SHA-256 digest", treeHash)
+	}
+
+	return digest, nil
+}
+
+// validateTreeHash checks that a pinned tree hash is well formed.
+func validateTreeHash(treeHash string) error {
+	_, err := decodeTreeHash(treeHash)
+	return err
+}
+
+// VerifyTreeHash compares the tree hash of dir against the expected value.
+func VerifyTreeHash(dir, expectedTreeHash string) error {
+	expected, err := decodeTreeHash(expectedTreeHash)
+	if err != nil {
+		return err
+	}
+
+	actualTreeHash, err := TreeHash(dir)
+	if err != nil {
+		return err
+	}
+
+	actual, err := decodeTreeHash(actualTreeHash)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(actual, expected) != 1 {
+		return fmt.Errorf("tree hash mismatch: expected %s, got %s", expectedTreeHash, actualTreeHash)
+	}
+
+	return nil
+}
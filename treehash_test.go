@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func createTestTree(t *testing.T) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err := os.MkdirAll(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatalf("Failed to create bin dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bin", "tool"), []byte("#!/bin/sh\necho tool"), 0755); err != nil {
+		t.Fatalf("Failed to write tool: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("readme"), 0644); err != nil {
+		t.Fatalf("Failed to write README: %v", err)
+	}
+
+	return dir
+}
+
+func TestTreeHash(t *testing.T) {
+	dir := createTestTree(t)
+
+	treeHash, err := TreeHash(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(treeHash, treeHashPrefix) {
+		t.Errorf("Expected tree hash to start with %q, got %q", treeHashPrefix, treeHash)
+	}
+
+	if err := validateTreeHash(treeHash); err != nil {
+		t.Errorf("Expected computed tree hash to be valid: %v", err)
+	}
+
+	otherDir := createTestTree(t)
+	otherTreeHash, err := TreeHash(otherDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if treeHash != otherTreeHash {
+		t.Errorf("Expected identical trees to hash the same, got %q and %q", treeHash, otherTreeHash)
+	}
+}
+
+func TestTreeHashDetectsChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(dir string) error
+	}{
+		{
+			name: "changed content",
+			modify: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "README"), []byte("changed"), 0644)
+			},
+		},
+		{
+			name: "added file",
+			modify: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "extra"), []byte("extra"), 0644)
+			},
+		},
+		{
+			name: "removed file",
+			modify: func(dir string) error {
+				return os.Remove(filepath.Join(dir, "README"))
+			},
+		},
+		{
+			name: "renamed file",
+			modify: func(dir string) error {
+				return os.Rename(filepath.Join(dir, "README"), filepath.Join(dir, "README.md"))
+			},
+		},
+		{
+			name: "added symlink",
+			modify: func(dir string) error {
+				return os.Symlink("README", filepath.Join(dir, "README.link"))
+			},
+		},
+		{
+			name: "executable bit removed",
+			modify: func(dir string) error {
+				return os.Chmod(filepath.Join(dir, "bin", "tool"), 0644)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := createTestTree(t)
+
+			treeHash, err := TreeHash(dir)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if err := tt.modify(dir); err != nil {
+				t.Fatalf("Failed to modify tree: %v", err)
+			}
+
+			if err := VerifyTreeHash(dir, treeHash); err == nil {
+				t.Errorf("Expected tree hash mismatch, but got none")
+			}
+		})
+	}
+}
+
+func TestTreeHashIgnoresGroupAndOtherBits(t *testing.T) {
+	dir := createTestTree(t)
+
+	treeHash, err := TreeHash(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := os.Chmod(filepath.Join(dir, "README"), 0600); err != nil {
+		t.Fatalf("Failed to chmod README: %v", err)
+	}
+
+	if err := VerifyTreeHash(dir, treeHash); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestValidateTreeHash(t *testing.T) {
+	tests := []struct {
+		name        string
+		treeHash    string
+		expectError bool
+	}{
+		{
+			name:        "valid tree hash",
+			treeHash:    "t1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+			expectError: false,
+		},
+		{
+			name:        "missing prefix",
+			treeHash:    "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+			expectError: true,
+		},
+		{
+			name:        "truncated digest",
+			treeHash:    "t1:47DEQpj8HBSa+/TImW+5JCeu",
+			expectError: true,
+		},
+		{
+			name:        "invalid base64",
+			treeHash:    "t1:not base64!",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTreeHash(tt.treeHash)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// currentLink is the symlink inside a versioned item directory that points
+// to the active version.
+const currentLink = "current"
+
+// itemLayout returns the directory an item is installed into and the name of
+// the entry it occupies there. Versioned items live in <output-dir>/<name>/
+// as one entry per version.
+func itemLayout(outputDir string, item FetchItem) (root, name string) {
+	if item.Versioned {
+		return filepath.Join(outputDir, item.Name), item.Version
+	}
+	return outputDir, item.Name
+}
+
+// installedItemPath returns the path of the active install of an item. For
+// versioned items it goes through the current symlink, so bin symlinks
+// follow rollbacks.
+func installedItemPath(outputDir string, item FetchItem) string {
+	if item.Versioned {
+		return filepath.Join(outputDir, item.Name, currentLink)
+	}
+	return filepath.Join(outputDir, item.Name)
+}
+
+// singleFilePath returns the downloaded file within an item path for items
+// that are not extracted. Versioned items keep it in the version directory.
+func singleFilePath(itemPath string, item FetchItem) string {
+	if item.Versioned {
+		return filepath.Join(itemPath, item.Name)
+	}
+	return itemPath
+}
+
+func (item FetchItem) GetKeepVersions(globalKeepVersions int) int {
+	if item.KeepVersions != 0 {
+		return item.KeepVersions
+	}
+	return globalKeepVersions
+}
+
+// versionsFile lists the versions of a versioned item in install order, one
+// per line. Directory times are not used because extracted trees get the
+// modification times of the archive.
+const versionsFile = ".versions"
+
+// readVersionOrder returns the versions recorded in the versions file, oldest
+// first.
+func readVersionOrder(itemRoot string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(itemRoot, versionsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read install order: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// writeVersionOrder replaces the versions file atomically.
+func writeVersionOrder(itemRoot string, versions []string) error {
+	var data strings.Builder
+	for _, version := range versions {
+		data.WriteString(version + "\n")
+	}
+
+	tmpFile, err := os.CreateTemp(itemRoot, versionsFile+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write install order: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(data.String()); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write install order: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write install order: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), filepath.Join(itemRoot, versionsFile)); err != nil {
+		return fmt.Errorf("failed to write install order: %w", err)
+	}
+	return nil
+}
+
+// recordVersion marks version as the most recently installed one.
+func recordVersion(itemRoot, version string) error {
+	order, err := readVersionOrder(itemRoot)
+	if err != nil {
+		return err
+	}
+
+	updated := make([]string, 0, len(order)+1)
+	for _, name := range order {
+		if name != version {
+			updated = append(updated, name)
+		}
+	}
+	return writeVersionOrder(itemRoot, append(updated, version))
+}
+
+// listVersions returns the installed versions of an item, oldest first, and
+// the version the current symlink points to. Versions missing from the
+// versions file are treated as the oldest, in name order.
+func listVersions(itemRoot string) ([]string, string, error) {
+	entries, err := os.ReadDir(itemRoot)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", itemRoot, err)
+	}
+
+	installed := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Name() == currentLink || strings.HasPrefix(entry.Name(), ".") || !entry.IsDir() {
+			continue
+		}
+		installed[entry.Name()] = true
+	}
+
+	order, err := readVersionOrder(itemRoot)
+	if err != nil {
+		return nil, "", err
+	}
+
+	recorded := make(map[string]bool, len(order))
+	var versions []string
+	for _, name := range order {
+		if installed[name] && !recorded[name] {
+			recorded[name] = true
+			versions = append(versions, name)
+		}
+	}
+	var unrecorded []string
+	for name := range installed {
+		if !recorded[name] {
+			unrecorded = append(unrecorded, name)
+		}
+	}
+	sort.Strings(unrecorded)
+	versions = append(unrecorded, versions...)
+
+	current, err := os.Readlink(filepath.Join(itemRoot, currentLink))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("failed to read current version: %w", err)
+	}
+
+	return versions, current, nil
+}
+
+// checkVersionedRoot makes sure the item directory can hold versions. An
+// install from the flat layout is not touched.
+func checkVersionedRoot(itemRoot string) error {
+	info, err := os.Lstat(itemRoot)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", itemRoot, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s exists and is not a versioned install, remove it first", itemRoot)
+	}
+
+	entries, err := os.ReadDir(itemRoot)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", itemRoot, err)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if _, err := os.Lstat(filepath.Join(itemRoot, currentLink)); err != nil {
+		return fmt.Errorf("%s exists and is not a versioned install, remove it first", itemRoot)
+	}
+
+	return nil
+}
+
+// setCurrentVersion points the current symlink at version, replacing the
+// previous link atomically. The returned function points it back.
+func setCurrentVersion(itemRoot, version string) (func() error, error) {
+	info, err := os.Stat(filepath.Join(itemRoot, version))
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("version %s is not installed in %s", version, itemRoot)
+	}
+
+	currentPath := filepath.Join(itemRoot, currentLink)
+	previous, err := os.Readlink(currentPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read current version: %w", err)
+	}
+
+	if err := replaceSymlink(currentPath, version); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Current version: %s -> %s\n", currentPath, version)
+
+	restore := func() error {
+		if previous == "" {
+			return os.Remove(currentPath)
+		}
+		return replaceSymlink(currentPath, previous)
+	}
+	return restore, nil
+}
+
+// replaceSymlink atomically points the symlink at linkPath to target.
+func replaceSymlink(linkPath, target string) error {
+	stagingDir, err := os.MkdirTemp(filepath.Dir(linkPath), "."+filepath.Base(linkPath)+".staging-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	stagedLink := filepath.Join(stagingDir, filepath.Base(linkPath))
+	if err := os.Symlink(target, stagedLink); err != nil {
+		return fmt.Errorf("failed to create symlink %s: %w", linkPath, err)
+	}
+
+	return swapIntoPlace(stagedLink, linkPath, filepath.Join(stagingDir, filepath.Base(linkPath)+".previous"))
+}
+
+// pruneVersions removes the oldest versions so that at most keep remain. The
+// current version is always kept. A keep of zero keeps everything.
+func pruneVersions(itemRoot string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	versions, current, err := listVersions(itemRoot)
+	if err != nil {
+		return err
+	}
+
+	excess := len(versions) - keep
+	var kept []string
+	for _, version := range versions {
+		if excess <= 0 || version == current {
+			kept = append(kept, version)
+			continue
+		}
+
+		versionPath := filepath.Join(itemRoot, version)
+		if err := os.RemoveAll(versionPath); err != nil {
+			return fmt.Errorf("failed to remove old version %s: %w", versionPath, err)
+		}
+		fmt.Printf("Removed old version: %s\n", versionPath)
+		excess--
+	}
+
+	return writeVersionOrder(itemRoot, kept)
+}
+
+// UseVersion switches a versioned item to an installed version.
+func UseVersion(config *Config, item FetchItem, version string) error {
+	if !item.Versioned {
+		return fmt.Errorf("item %s does not use the versioned layout", item.Name)
+	}
+
+	outputDir := item.GetOutputDir(config.OutputDir)
+	if outputDir == "" {
+		return fmt.Errorf("output-dir not specified")
+	}
+	if !isVersionName(version) {
+		return fmt.Errorf("invalid version %q", version)
+	}
+
+	_, err := setCurrentVersion(filepath.Join(outputDir, item.Name), version)
+	return err
+}
+
+// RollbackVersion switches a versioned item to the version installed before
+// the current one and returns its name.
+func RollbackVersion(config *Config, item FetchItem) (string, error) {
+	if !item.Versioned {
+		return "", fmt.Errorf("item %s does not use the versioned layout", item.Name)
+	}
+
+	outputDir := item.GetOutputDir(config.OutputDir)
+	if outputDir == "" {
+		return "", fmt.Errorf("output-dir not specified")
+	}
+
+	itemRoot := filepath.Join(outputDir, item.Name)
+	versions, current, err := listVersions(itemRoot)
+	if err != nil {
+		return "", err
+	}
+
+	previous := ""
+	for _, version := range versions {
+		if version == current {
+			break
+		}
+		previous = version
+	}
+	if previous == "" {
+		return "", fmt.Errorf("no version of %s installed before %s", item.Name, current)
+	}
+
+	if _, err := setCurrentVersion(itemRoot, previous); err != nil {
+		return "", err
+	}
+
+	return previous, nil
+}
+
+// isVersionName reports whether a version can be used as a directory name in
+// the versioned layout.
+func isVersionName(version string) bool {
+	return version != currentLink && !strings.HasPrefix(version, ".") &&
+		filepath.Base(version) == version && filepath.IsLocal(version)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVersionedInstall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("tool " + strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outputDir := filepath.Join(tmpDir, "output")
+	binDir := filepath.Join(tmpDir, "bin")
+
+	config := &Config{
+		OutputDir:    outputDir,
+		BinsDir:      binDir,
+		KeepVersions: 2,
+	}
+
+	newItem := func(version string) FetchItem {
+		return FetchItem{
+			Name:      "tool",
+			URL:       server.URL + "/$version",
+			Version:   version,
+			Hash:      fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("tool "+version))),
+			BinFile:   true,
+			Versioned: true,
+		}
+	}
+
+	expectBin := func(version string) {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(binDir, "tool"))
+		if err != nil {
+			t.Fatalf("Failed to read through bin symlink: %v", err)
+		}
+		if string(content) != "tool "+version {
+			t.Errorf("Expected bin symlink to reach version %s, got %q", version, content)
+		}
+	}
+
+	for _, version := range []string{"1.0", "2.0", "3.0"} {
+		if err := ProcessFetchItem(config, newItem(version)); err != nil {
+			t.Fatalf("Unexpected error installing %s: %v", version, err)
+		}
+		expectBin(version)
+	}
+
+	itemRoot := filepath.Join(outputDir, "tool")
+	versions, current, err := listVersions(itemRoot)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if current != "3.0" {
+		t.Errorf("Expected current version 3.0, got %s", current)
+	}
+	if len(versions) != 2 || versions[0] != "2.0" || versions[1] != "3.0" {
+		t.Errorf("Expected versions 2.0 and 3.0 to be kept, got %v", versions)
+	}
+
+	link, err := os.Readlink(filepath.Join(binDir, "tool"))
+	if err != nil {
+		t.Fatalf("Failed to read bin symlink: %v", err)
+	}
+	if !strings.Contains(link, currentLink) {
+		t.Errorf("Expected bin symlink to go through %s, got %s", currentLink, link)
+	}
+
+	version, err := RollbackVersion(config, newItem("3.0"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if version != "2.0" {
+		t.Errorf("Expected rollback to 2.0, got %s", version)
+	}
+	expectBin("2.0")
+
+	if _, err := RollbackVersion(config, newItem("3.0")); err == nil {
+		t.Errorf("Expected error rolling back past the oldest version, but got none")
+	}
+
+	if err := UseVersion(config, newItem("3.0"), "3.0"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectBin("3.0")
+
+	if err := UseVersion(config, newItem("3.0"), "1.0"); err == nil {
+		t.Errorf("Expected error switching to a pruned version, but got none")
+	}
+	expectBin("3.0")
+}
+
+func TestVersionedInstallBinModes(t *testing.T) {
+	script := func(version string) string {
+		return "#!/bin/sh\necho tool " + version + "\n"
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(script(strings.TrimPrefix(r.URL.Path, "/"))))
+	}))
+	defer server.Close()
+
+	for _, mode := range []string{binModeSymlink, binModeRelativeSymlink, binModeShim} {
+		t.Run(mode, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			binDir := filepath.Join(tmpDir, "bin")
+			config := &Config{
+				OutputDir: filepath.Join(tmpDir, "output"),
+				BinsDir:   binDir,
+				BinMode:   mode,
+			}
+
+			newItem := func(version string) FetchItem {
+				return FetchItem{
+					Name:      "tool",
+					URL:       server.URL + "/$version",
+					Version:   version,
+					Hash:      fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(script(version)))),
+					BinFile:   true,
+					Versioned: true,
+				}
+			}
+
+			expectBin := func(version string) {
+				t.Helper()
+				output, err := exec.Command(filepath.Join(binDir, "tool")).Output()
+				if err != nil {
+					t.Fatalf("Failed to run bin entry: %v", err)
+				}
+				if string(output) != "tool "+version+"\n" {
+					t.Errorf("Expected bin entry to run version %s, got %q", version, output)
+				}
+			}
+
+			for _, version := range []string{"1.0", "2.0"} {
+				if err := ProcessFetchItem(config, newItem(version)); err != nil {
+					t.Fatalf("Unexpected error installing %s: %v", version, err)
+				}
+			}
+			expectBin("2.0")
+
+			if _, err := RollbackVersion(config, newItem("2.0")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expectBin("1.0")
+
+			if err := UseVersion(config, newItem("2.0"), "2.0"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expectBin("2.0")
+		})
+	}
+}
+
+func TestVersionedInstallOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("tool " + strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := &Config{
+		OutputDir:    filepath.Join(tmpDir, "output"),
+		KeepVersions: 2,
+	}
+	itemRoot := filepath.Join(config.OutputDir, "tool")
+
+	newItem := func(version string) FetchItem {
+		return FetchItem{
+			Name:      "tool",
+			URL:       server.URL + "/$version",
+			Version:   version,
+			Hash:      fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("tool "+version))),
+			Versioned: true,
+		}
+	}
+
+	// Installed out of name order, with directory times that run backwards
+	// like those of archives normalized to old release dates
+	installTimes := map[string]time.Time{
+		"2.0": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"1.0": time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		"3.0": time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for _, version := range []string{"2.0", "1.0", "3.0"} {
+		if err := ProcessFetchItem(config, newItem(version)); err != nil {
+			t.Fatalf("Unexpected error installing %s: %v", version, err)
+		}
+		modTime := installTimes[version]
+		if err := os.Chtimes(filepath.Join(itemRoot, version), modTime, modTime); err != nil {
+			t.Fatalf("Failed to set directory time: %v", err)
+		}
+	}
+
+	versions, current, err := listVersions(itemRoot)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if current != "3.0" {
+		t.Errorf("Expected current version 3.0, got %s", current)
+	}
+	if len(versions) != 2 || versions[0] != "1.0" || versions[1] != "3.0" {
+		t.Errorf("Expected versions 1.0 and 3.0 to be kept in install order, got %v", versions)
+	}
+
+	version, err := RollbackVersion(config, newItem("3.0"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if version != "1.0" {
+		t.Errorf("Expected rollback to 1.0, got %s", version)
+	}
+}
+
+func TestVersionedInstallRejectsFlatInstall(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	flatFile := filepath.Join(tmpDir, "flat-file")
+	if err := os.WriteFile(flatFile, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create flat file: %v", err)
+	}
+	flatDir := filepath.Join(tmpDir, "flat-dir")
+	if err := os.MkdirAll(filepath.Join(flatDir, "bin"), 0755); err != nil {
+		t.Fatalf("Failed to create flat dir: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		root        string
+		expectError bool
+	}{
+		{
+			name: "missing",
+			root: filepath.Join(tmpDir, "missing"),
+		},
+		{
+			name:        "flat file",
+			root:        flatFile,
+			expectError: true,
+		},
+		{
+			name:        "flat directory",
+			root:        flatDir,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVersionedRoot(tt.root)
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error, but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyVersionedItem(t *testing.T) {
+	data := []byte("tool 1.0")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "verifetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	config := &Config{OutputDir: filepath.Join(tmpDir, "output")}
+	item := FetchItem{
+		Name:      "tool",
+		URL:       server.URL + "/tool",
+		Version:   "1.0",
+		Hash:      fmt.Sprintf("sha256:%x", sha256.Sum256(data)),
+		Versioned: true,
+	}
+
+	if err := ProcessFetchItem(config, item); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	checked, err := VerifyInstalledItem(config, item)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !checked {
+		t.Errorf("Expected versioned item to be verified")
+	}
+
+	installed := filepath.Join(config.OutputDir, "tool", "1.0", "tool")
+	if err := os.WriteFile(installed, []byte("tampered"), 0644); err != nil {
+		t.Fatalf("Failed to tamper with installed file: %v", err)
+	}
+	if _, err := VerifyInstalledItem(config, item); err == nil {
+		t.Errorf("Expected error for tampered file, but got none")
+	}
+}
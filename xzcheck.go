@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// xzMaxDictSize caps the LZMA2 dictionary an xz block may request. The xz
+// decoder allocates the dictionary named in each block header up front, so
+// this is checked before decoding starts. It covers archives made with
+// "xz -9" while refusing crafted headers that ask for gigabytes.
+const xzMaxDictSize = 64 << 20
+
+var (
+	xzHeaderMagic = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	xzFooterMagic = []byte{'Y', 'Z'}
+)
+
+// xzLZMA2FilterID is the only filter the xz decoder supports.
+const xzLZMA2FilterID = 0x21
+
+// checkXzDictSizes walks the streams and blocks of xz data without
+// decompressing anything and rejects any block whose LZMA2 dictionary is
+// larger than xzMaxDictSize. Blocks are skipped by their LZMA2 chunk headers,
+// so every block header the decoder will read is checked.
+func checkXzDictSizes(data []byte) error {
+	pos := 0
+	for pos < len(data) {
+		// Streams may be followed by padding of zero bytes in groups of four
+		if pos > 0 && data[pos] == 0 {
+			if pos+4 > len(data) || !bytes.Equal(data[pos:pos+4], []byte{0, 0, 0, 0}) {
+				return fmt.Errorf("invalid xz stream padding")
+			}
+			pos += 4
+			continue
+		}
+
+		end, err := checkXzStream(data, pos)
+		if err != nil {
+			return err
+		}
+		pos = end
+	}
+	return nil
+}
+
+// checkXzStream checks the blocks of the stream starting at pos and returns
+// where it ends.
+func checkXzStream(data []byte, pos int) (int, error) {
+	if pos+12 > len(data) || !bytes.Equal(data[pos:pos+6], xzHeaderMagic) {
+		return 0, fmt.Errorf("invalid xz stream header")
+	}
+	checkType := data[pos+7] & 0x0f
+	checkSize := 0
+	if checkType != 0 {
+		checkSize = 4 << ((checkType - 1) / 3)
+	}
+	pos += 12
+
+	for {
+		if pos >= len(data) {
+			return 0, fmt.Errorf("truncated xz stream")
+		}
+		// A zero size byte starts the index instead of another block
+		if data[pos] == 0 {
+			break
+		}
+
+		blockStart := pos
+		headerEnd, err := checkXzBlockHeader(data, pos)
+		if err != nil {
+			return 0, err
+		}
+		pos, err = skipLZMA2Chunks(data, headerEnd)
+		if err != nil {
+			return 0, err
+		}
+		pos += (4 - (pos-blockStart)%4) % 4
+		pos += checkSize
+	}
+
+	indexStart := pos
+	pos++
+	records, pos, err := readXzVarint(data, pos)
+	if err != nil {
+		return 0, err
+	}
+	for i := uint64(0); i < records; i++ {
+		// Unpadded and uncompressed size of each block
+		for j := 0; j < 2; j++ {
+			if _, pos, err = readXzVarint(data, pos); err != nil {
+				return 0, err
+			}
+		}
+	}
+	pos += (4 - (pos-indexStart)%4) % 4
+	pos += 4 // index CRC32
+
+	if pos+12 > len(data) || !bytes.Equal(data[pos+10:pos+12], xzFooterMagic) {
+		return 0, fmt.Errorf("invalid xz stream footer")
+	}
+	return pos + 12, nil
+}
+
+// checkXzBlockHeader checks the filter of the block header at pos and returns
+// where the header ends.
+func checkXzBlockHeader(data []byte, pos int) (int, error) {
+	headerEnd := pos + (int(data[pos])+1)*4
+	if pos+2 > len(data) || headerEnd > len(data) {
+		return 0, fmt.Errorf("truncated xz block header")
+	}
+
+	flags := data[pos+1]
+	if flags&0x03 != 0 {
+		return 0, fmt.Errorf("unsupported xz filter chain")
+	}
+	pos += 2
+
+	var err error
+	// Optional compressed and uncompressed sizes
+	for _, present := range []bool{flags&0x40 != 0, flags&0x80 != 0} {
+		if present {
+			if _, pos, err = readXzVarint(data, pos); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	filterID, pos, err := readXzVarint(data, pos)
+	if err != nil {
+		return 0, err
+	}
+	propsSize, pos, err := readXzVarint(data, pos)
+	if err != nil {
+		return 0, err
+	}
+	if filterID != xzLZMA2FilterID || propsSize != 1 || pos >= headerEnd {
+		return 0, fmt.Errorf("unsupported xz filter %#x", filterID)
+	}
+
+	dictSize, err := lzma2DictSize(data[pos])
+	if err != nil {
+		return 0, err
+	}
+	if dictSize > xzMaxDictSize {
+		return 0, fmt.Errorf("xz dictionary of %d bytes exceeds the limit of %d bytes", dictSize, xzMaxDictSize)
+	}
+
+	return headerEnd, nil
+}
+
+// lzma2DictSize decodes the dictionary size property of the LZMA2 filter.
+func lzma2DictSize(code byte) (int64, error) {
+	switch {
+	case code > 40:
+		return 0, fmt.Errorf("invalid xz dictionary size code %d", code)
+	case code == 40:
+		return 1<<32 - 1, nil
+	default:
+		return int64(2|code&1) << (code/2 + 11), nil
+	}
+}
+
+// skipLZMA2Chunks returns the position after the end marker of the LZMA2
+// data starting at pos, using only the chunk headers.
+func skipLZMA2Chunks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, fmt.Errorf("truncated xz block")
+		}
+
+		control := data[pos]
+		switch {
+		case control == 0x00:
+			return pos + 1, nil
+		case control == 0x01 || control == 0x02:
+			if pos+3 > len(data) {
+				return 0, fmt.Errorf("truncated xz block")
+			}
+			pos += 3 + int(binary.BigEndian.Uint16(data[pos+1:pos+3])) + 1
+		case control >= 0x80:
+			headerSize := 5
+			if control >= 0xc0 {
+				headerSize = 6
+			}
+			if pos+headerSize > len(data) {
+				return 0, fmt.Errorf("truncated xz block")
+			}
+			pos += headerSize + int(binary.BigEndian.Uint16(data[pos+3:pos+5])) + 1
+		default:
+			return 0, fmt.Errorf("invalid LZMA2 chunk in xz block")
+		}
+	}
+}
+
+// readXzVarint reads a multibyte integer as used in xz headers.
+func readXzVarint(data []byte, pos int) (uint64, int, error) {
+	var value uint64
+	for i := 0; i < 9; i++ {
+		if pos >= len(data) {
+			return 0, 0, fmt.Errorf("truncated xz header")
+		}
+		b := data[pos]
+		pos++
+		value |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return value, pos, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid xz integer")
+}